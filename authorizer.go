@@ -0,0 +1,204 @@
+package elevate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// ErrUnauthorized is an error to deny the connection with 401 Unauthorized.
+// same as Lambda REQUEST authorizer returns `Unauthorized` error.
+var ErrUnauthorized = errors.New("Unauthorized")
+
+// Authorizer is a function to emulate Lambda REQUEST authorizer on $connect route. for local.
+//
+// if Authorizer returns ErrUnauthorized, the bridge denies upgrade with 401 Unauthorized.
+// if the policy document of the response does not allow `execute-api:Invoke` on the method ARN, the bridge denies upgrade with 403 Forbidden.
+// otherwise, principalId and context of the response are set to requestContext.authorizer of all events on the connection.
+type Authorizer func(ctx context.Context, req *events.APIGatewayCustomAuthorizerRequestTypeRequest) (*events.APIGatewayCustomAuthorizerResponse, error)
+
+// AuthorizerFromHandler returns Authorizer with http.Handler.
+//
+// the handler receives *http.Request that has headers and query string of $connect request,
+// and the handler writes IAM policy shaped JSON response, same as Lambda REQUEST authorizer returns.
+// if the handler responds 401 Unauthorized, it treats as ErrUnauthorized.
+// if the handler responds 403 Forbidden, it treats as denied.
+func AuthorizerFromHandler(handler http.Handler) Authorizer {
+	return func(ctx context.Context, authReq *events.APIGatewayCustomAuthorizerRequestTypeRequest) (*events.APIGatewayCustomAuthorizerResponse, error) {
+		u := url.URL{
+			Scheme:   "ws",
+			Host:     authReq.Headers["Host"],
+			Path:     authReq.Resource,
+			RawQuery: url.Values(authReq.MultiValueQueryStringParameters).Encode(),
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range authReq.MultiValueHeaders {
+			for _, vv := range v {
+				req.Header.Add(k, vv)
+			}
+		}
+		req.Header.Del("Host")
+		req.RemoteAddr = authReq.RequestContext.Identity.SourceIP
+		w := NewResponseWriter()
+		handler.ServeHTTP(w, req)
+		switch w.statusCode {
+		case http.StatusOK:
+		case http.StatusUnauthorized:
+			return nil, ErrUnauthorized
+		case http.StatusForbidden:
+			return &events.APIGatewayCustomAuthorizerResponse{
+				PolicyDocument: events.APIGatewayCustomAuthorizerPolicy{
+					Version: "2012-10-17",
+					Statement: []events.IAMPolicyStatement{
+						{
+							Action:   []string{"execute-api:Invoke"},
+							Effect:   "Deny",
+							Resource: []string{authReq.MethodArn},
+						},
+					},
+				},
+			}, nil
+		default:
+			return nil, fmt.Errorf("authorizer handler responds %d", w.statusCode)
+		}
+		var resp authorizerResponse
+		if err := json.Unmarshal(w.Bytes(), &resp); err != nil {
+			return nil, fmt.Errorf("failed to decode authorizer response: %w", err)
+		}
+		return resp.toEvent(), nil
+	}
+}
+
+// authorizerResponse is a IAM policy shaped authorizer response, Action and Resource accepts both string and list.
+type authorizerResponse struct {
+	PrincipalID    string `json:"principalId"`
+	PolicyDocument struct {
+		Version   string `json:"Version"`
+		Statement []struct {
+			Action   stringOrSlice `json:"Action"`
+			Effect   string        `json:"Effect"`
+			Resource stringOrSlice `json:"Resource"`
+		} `json:"Statement"`
+	} `json:"policyDocument"`
+	Context map[string]interface{} `json:"context"`
+}
+
+func (r *authorizerResponse) toEvent() *events.APIGatewayCustomAuthorizerResponse {
+	resp := &events.APIGatewayCustomAuthorizerResponse{
+		PrincipalID: r.PrincipalID,
+		PolicyDocument: events.APIGatewayCustomAuthorizerPolicy{
+			Version: r.PolicyDocument.Version,
+		},
+		Context: r.Context,
+	}
+	for _, s := range r.PolicyDocument.Statement {
+		resp.PolicyDocument.Statement = append(resp.PolicyDocument.Statement, events.IAMPolicyStatement{
+			Action:   s.Action,
+			Effect:   s.Effect,
+			Resource: s.Resource,
+		})
+	}
+	return resp
+}
+
+type stringOrSlice []string
+
+func (s *stringOrSlice) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*s = []string{str}
+		return nil
+	}
+	var strs []string
+	if err := json.Unmarshal(data, &strs); err != nil {
+		return err
+	}
+	*s = strs
+	return nil
+}
+
+func localRegion() string {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	return region
+}
+
+const (
+	localAccountID = "123456789012"
+	localAPIID     = "local"
+)
+
+func localMethodArn(stage string, routeKey string) string {
+	if stage == "" {
+		stage = "$default"
+	}
+	return fmt.Sprintf("arn:aws:execute-api:%s:%s:%s/%s/%s", localRegion(), localAccountID, localAPIID, stage, routeKey)
+}
+
+// isAllowed evaluates policy document same as API Gateway, explicit Deny is prior to Allow.
+func isAllowed(policy events.APIGatewayCustomAuthorizerPolicy, methodArn string) bool {
+	allowed := false
+	for _, s := range policy.Statement {
+		if !matchAny(s.Action, "execute-api:Invoke") || !matchAny(s.Resource, methodArn) {
+			continue
+		}
+		switch {
+		case strings.EqualFold(s.Effect, "Deny"):
+			return false
+		case strings.EqualFold(s.Effect, "Allow"):
+			allowed = true
+		}
+	}
+	return allowed
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if matchWildcard(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchWildcard reports whether s matches pattern, pattern can contain `*` and `?` as IAM policy.
+func matchWildcard(pattern, s string) bool {
+	if pattern == "" {
+		return s == ""
+	}
+	switch pattern[0] {
+	case '*':
+		for i := 0; i <= len(s); i++ {
+			if matchWildcard(pattern[1:], s[i:]) {
+				return true
+			}
+		}
+		return false
+	case '?':
+		return s != "" && matchWildcard(pattern[1:], s[1:])
+	}
+	return s != "" && pattern[0] == s[0] && matchWildcard(pattern[1:], s[1:])
+}
+
+// authorizerContext returns requestContext.authorizer value from authorizer response.
+func authorizerContext(resp *events.APIGatewayCustomAuthorizerResponse, integrationLatency int64) map[string]interface{} {
+	authCtx := make(map[string]interface{}, len(resp.Context)+2)
+	for k, v := range resp.Context {
+		authCtx[k] = v
+	}
+	authCtx["principalId"] = resp.PrincipalID
+	authCtx["integrationLatency"] = integrationLatency
+	return authCtx
+}
@@ -0,0 +1,156 @@
+package elevate_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/gorilla/websocket"
+	"github.com/mashiike/elevate"
+)
+
+func testAuthorizer(ctx context.Context, req *events.APIGatewayCustomAuthorizerRequestTypeRequest) (*events.APIGatewayCustomAuthorizerResponse, error) {
+	token := req.QueryStringParameters["token"]
+	if token == "" {
+		token = req.Headers["Authorization"]
+	}
+	effect := "Allow"
+	switch token {
+	case "":
+		return nil, elevate.ErrUnauthorized
+	case "deny":
+		effect = "Deny"
+	}
+	return &events.APIGatewayCustomAuthorizerResponse{
+		PrincipalID: "user-" + token,
+		PolicyDocument: events.APIGatewayCustomAuthorizerPolicy{
+			Version: "2012-10-17",
+			Statement: []events.IAMPolicyStatement{
+				{
+					Action:   []string{"execute-api:Invoke"},
+					Effect:   effect,
+					Resource: []string{req.MethodArn},
+				},
+			},
+		},
+		Context: map[string]interface{}{
+			"role": "member",
+		},
+	}, nil
+}
+
+func testAuthorizerHandler(w http.ResponseWriter, req *http.Request) {
+	token := req.URL.Query().Get("token")
+	if token == "" {
+		token = req.Header.Get("Authorization")
+	}
+	switch token {
+	case "":
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	case "deny":
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{
+		"principalId": "user-%s",
+		"policyDocument": {
+			"Version": "2012-10-17",
+			"Statement": [{"Action": "execute-api:Invoke", "Effect": "Allow", "Resource": "arn:aws:execute-api:*"}]
+		},
+		"context": {"role": "member"}
+	}`, token)
+}
+
+func TestWebsocketHTTPBridgeHandler__Authorizer(t *testing.T) {
+	authorizers := map[string]elevate.Authorizer{
+		"func":    testAuthorizer,
+		"handler": elevate.AuthorizerFromHandler(http.HandlerFunc(testAuthorizerHandler)),
+	}
+	for name, authorizer := range authorizers {
+		t.Run(name, func(t *testing.T) {
+			var disconnectAuthorizer map[string]interface{}
+			done := make(chan struct{})
+			mux := elevate.NewRouteMux()
+			mux.HandleConnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if elevate.PrincipalID(req) == "" {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				if elevate.SourceIP(req) != "127.0.0.1" {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			mux.HandleDisconnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				disconnectAuthorizer = elevate.AuthorizerContext(req)
+				close(done)
+			}))
+			mux.HandleDefault(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				json.NewEncoder(w).Encode(elevate.ProxyRequestContext(req.Context()).Authorizer)
+			}))
+			handler := elevate.NewWebsocketHTTPBridgeHandler(mux)
+			handler.SetAuthorizer(authorizer)
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			handler.SetCallbackURL(server.URL)
+			connectURL := "ws://" + server.Listener.Addr().String() + "/"
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, resp, err := websocket.DefaultDialer.DialContext(ctx, connectURL, nil)
+			if err == nil {
+				t.Fatal("dial without token succeeded; want error")
+			}
+			if resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("resp.StatusCode = %d; want %d", resp.StatusCode, http.StatusUnauthorized)
+			}
+			_, resp, err = websocket.DefaultDialer.DialContext(ctx, connectURL+"?token=deny", nil)
+			if err == nil {
+				t.Fatal("dial with deny token succeeded; want error")
+			}
+			if resp.StatusCode != http.StatusForbidden {
+				t.Errorf("resp.StatusCode = %d; want %d", resp.StatusCode, http.StatusForbidden)
+			}
+
+			c, _, err := websocket.DefaultDialer.DialContext(ctx, connectURL, http.Header{"Authorization": []string{"alice"}})
+			if err != nil {
+				t.Fatal("dial:", err)
+			}
+			if err := c.WriteMessage(websocket.TextMessage, []byte(`hello`)); err != nil {
+				t.Fatal("write:", err)
+			}
+			_, message, err := c.ReadMessage()
+			if err != nil {
+				t.Fatal("read:", err)
+			}
+			var authCtx map[string]interface{}
+			if err := json.Unmarshal(message, &authCtx); err != nil {
+				t.Fatalf("unexpected message: `%s`", message)
+			}
+			if authCtx["principalId"] != "user-alice" {
+				t.Errorf("principalId = %v; want user-alice", authCtx["principalId"])
+			}
+			if authCtx["role"] != "member" {
+				t.Errorf("role = %v; want member", authCtx["role"])
+			}
+			c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			c.Close()
+			select {
+			case <-done:
+			case <-ctx.Done():
+				t.Fatal("$disconnect is not called")
+			}
+			if disconnectAuthorizer["principalId"] != "user-alice" {
+				t.Errorf("authorizer on $disconnect = %v; want principalId user-alice", disconnectAuthorizer)
+			}
+		})
+	}
+}
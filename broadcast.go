@@ -0,0 +1,134 @@
+package elevate
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi"
+)
+
+// DefaultBroadcastConcurrency is a default number of concurrent PostToConnection calls in Broadcast.
+var DefaultBroadcastConcurrency = 10
+
+// BroadcastResult is a result of Broadcast.
+type BroadcastResult struct {
+	// Delivered is a list of connection ids that data is posted successfully.
+	Delivered []string
+	// Gone is a list of connection ids that PostToConnection returned GoneException.
+	Gone []string
+	// Failed is a map of connection id and error, except GoneException.
+	Failed map[string]error
+}
+
+type broadcastOptions struct {
+	concurrency int
+	rateLimit   float64
+}
+
+type BroadcastOption func(*broadcastOptions)
+
+// WithBroadcastConcurrency sets the number of concurrent PostToConnection calls in Broadcast.
+func WithBroadcastConcurrency(concurrency int) BroadcastOption {
+	return func(o *broadcastOptions) {
+		if concurrency > 0 {
+			o.concurrency = concurrency
+		}
+	}
+}
+
+// WithBroadcastRateLimit sets the maximum number of PostToConnection calls per second in Broadcast.
+// zero or negative value means no limit, and so does the value above one billion.
+func WithBroadcastRateLimit(perSecond float64) BroadcastOption {
+	return func(o *broadcastOptions) {
+		o.rateLimit = perSecond
+	}
+}
+
+// Broadcast posts data to connectionIDs with one @connections API client and bounded concurrency.
+//
+// it returns error only if the client cannot be created or the context is done,
+// each failure of PostToConnection is reported in BroadcastResult.
+// if ConnectionStoreHandler is used, gone connections are pruned from ConnectionStore.
+func Broadcast(ctx context.Context, connectionIDs []string, data []byte, opts ...BroadcastOption) (*BroadcastResult, error) {
+	o := broadcastOptions{
+		concurrency: DefaultBroadcastConcurrency,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	client, err := ManagementClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var tick <-chan time.Time
+	if o.rateLimit > 0 {
+		// the interval rounds to zero for very high rate limit, it is treated as no limit.
+		if interval := time.Duration(float64(time.Second) / o.rateLimit); interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+	}
+	result := &BroadcastResult{
+		Delivered: make([]string, 0, len(connectionIDs)),
+		Gone:      make([]string, 0),
+		Failed:    make(map[string]error),
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan string)
+	for i := 0; i < o.concurrency && i < len(connectionIDs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for connectionID := range queue {
+				_, err := client.PostToConnection(ctx, &apigatewaymanagementapi.PostToConnectionInput{
+					ConnectionId: aws.String(connectionID),
+					Data:         data,
+				})
+				pruneGoneConnection(ctx, connectionID, err)
+				mu.Lock()
+				switch {
+				case err == nil:
+					result.Delivered = append(result.Delivered, connectionID)
+				case ConnectionIsGone(err):
+					result.Gone = append(result.Gone, connectionID)
+				default:
+					result.Failed[connectionID] = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	var ctxErr error
+	for i, connectionID := range connectionIDs {
+		if tick != nil && i > 0 {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() == nil {
+			select {
+			case queue <- connectionID:
+				continue
+			case <-ctx.Done():
+			}
+		}
+		ctxErr = ctx.Err()
+		mu.Lock()
+		for _, id := range connectionIDs[i:] {
+			result.Failed[id] = ctxErr
+		}
+		mu.Unlock()
+		break
+	}
+	close(queue)
+	wg.Wait()
+	sort.Strings(result.Delivered)
+	sort.Strings(result.Gone)
+	return result, ctxErr
+}
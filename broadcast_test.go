@@ -0,0 +1,113 @@
+package elevate_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mashiike/elevate"
+)
+
+func TestBroadcast(t *testing.T) {
+	store := elevate.NewInMemoryConnectionStore()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := store.Put(ctx, &elevate.Connection{ConnectionID: "GONEGONEGONEGON="}); err != nil {
+		t.Fatal(err)
+	}
+	broadcasted := make(chan *elevate.BroadcastResult, 1)
+	mux := elevate.NewRouteMux()
+	mux.HandleFunc("broadcast", func(w http.ResponseWriter, req *http.Request) {
+		conns, err := store.List(req.Context())
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		ids := make([]string, 0, len(conns))
+		for _, conn := range conns {
+			ids = append(ids, conn.ConnectionID)
+		}
+		result, err := elevate.Broadcast(
+			req.Context(), ids, []byte("hello"),
+			elevate.WithBroadcastConcurrency(2),
+			elevate.WithBroadcastRateLimit(100),
+		)
+		if err != nil {
+			t.Errorf("Broadcast() error = %v; want nil", err)
+		}
+		broadcasted <- result
+	})
+	handler := elevate.NewWebsocketHTTPBridgeHandler(elevate.NewConnectionStoreHandler(store, mux))
+	handler.SetRouteResponse("broadcast", false)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	handler.SetCallbackURL(server.URL)
+
+	clients := make([]*websocket.Conn, 3)
+	for i := range clients {
+		c, _, err := websocket.DefaultDialer.DialContext(ctx, "ws://"+server.Listener.Addr().String()+"/", nil)
+		if err != nil {
+			t.Fatal("dial:", err)
+		}
+		defer c.Close()
+		clients[i] = c
+	}
+	if err := clients[0].WriteMessage(websocket.TextMessage, []byte(`{"action":"broadcast"}`)); err != nil {
+		t.Fatal("write:", err)
+	}
+	for i, c := range clients {
+		_, message, err := c.ReadMessage()
+		if err != nil {
+			t.Fatal("read:", err)
+		}
+		if string(message) != "hello" {
+			t.Errorf("client[%d] unexpected message: `%s`", i, message)
+		}
+	}
+	select {
+	case result := <-broadcasted:
+		if result == nil {
+			t.Fatal("Broadcast() returns nil result")
+		}
+		if len(result.Delivered) != 3 {
+			t.Errorf("len(Delivered) = %d; want 3", len(result.Delivered))
+		}
+		if len(result.Gone) != 1 || result.Gone[0] != "GONEGONEGONEGON=" {
+			t.Errorf("Gone = %v; want [GONEGONEGONEGON=]", result.Gone)
+		}
+		if len(result.Failed) != 0 {
+			t.Errorf("Failed = %v; want empty", result.Failed)
+		}
+	case <-ctx.Done():
+		t.Fatal("broadcast is not finished")
+	}
+	conns, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conns) != 3 {
+		t.Errorf("len(List()) = %d; want 3, gone connection should be pruned", len(conns))
+	}
+}
+
+func TestBroadcast__HighRateLimit(t *testing.T) {
+	stub := &stubManagementAPIClient{posts: make(map[string][]byte)}
+	ctx := elevate.ContextWithManagementAPIClient(context.Background(), stub)
+	result, err := elevate.Broadcast(ctx, []string{"AAAAAAAAAAAAAAA=", "BBBBBBBBBBBBBBB="}, []byte("hello"), elevate.WithBroadcastRateLimit(1e10))
+	if err != nil {
+		t.Fatalf("Broadcast() error = %v; want nil", err)
+	}
+	if len(result.Delivered) != 2 {
+		t.Errorf("len(Delivered) = %d; want 2", len(result.Delivered))
+	}
+}
+
+func TestBroadcast__CallbackURLIsEmpty(t *testing.T) {
+	_, err := elevate.Broadcast(context.Background(), []string{"AAAAAAAAAAAAAAA="}, []byte("hello"))
+	if err == nil {
+		t.Error("Broadcast() without callback url succeeded; want error")
+	}
+}
@@ -3,57 +3,195 @@ package elevate
 import (
 	"context"
 	"errors"
-	"os"
+	"net/url"
+	"reflect"
 	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi"
 	"github.com/aws/smithy-go"
 )
 
-func NewManagementAPIClient(ctx context.Context) (*apigatewaymanagementapi.Client, error) {
+// ManagementAPIClient is an interface of @connections API client, *apigatewaymanagementapi.Client implements it.
+type ManagementAPIClient interface {
+	PostToConnection(ctx context.Context, params *apigatewaymanagementapi.PostToConnectionInput, optFns ...func(*apigatewaymanagementapi.Options)) (*apigatewaymanagementapi.PostToConnectionOutput, error)
+	DeleteConnection(ctx context.Context, params *apigatewaymanagementapi.DeleteConnectionInput, optFns ...func(*apigatewaymanagementapi.Options)) (*apigatewaymanagementapi.DeleteConnectionOutput, error)
+	GetConnection(ctx context.Context, params *apigatewaymanagementapi.GetConnectionInput, optFns ...func(*apigatewaymanagementapi.Options)) (*apigatewaymanagementapi.GetConnectionOutput, error)
+}
+
+var _ ManagementAPIClient = (*apigatewaymanagementapi.Client)(nil)
+
+// LocalCredentials is the dummy credentials of @connections API client for local bridge.
+var LocalCredentials = aws.Credentials{
+	AccessKeyID:     "AWS_ACCESS_KEY_ID",
+	SecretAccessKey: "AWS_SECRET_ACCESS_KEY",
+	SessionToken:    "AWS_SESSION_TOKEN",
+}
+
+// managementAPIClientCache is a cache of @connections API client keyed by endpoint and aws.Config in context.
+type managementAPIClientCache struct {
+	mu      sync.Mutex
+	clients map[managementAPIClientKey]*apigatewaymanagementapi.Client
+}
+
+// managementAPIClientKey identifies the client, region and credentials provider of aws.Config in context are part of it.
+// so the client built with the config of other caller is not reused.
+type managementAPIClientKey struct {
+	endpoint    string
+	local       bool
+	region      string
+	credentials aws.CredentialsProvider
+}
+
+var clientCache = &managementAPIClientCache{
+	clients: make(map[managementAPIClientKey]*apigatewaymanagementapi.Client),
+}
+
+func (c *managementAPIClientCache) get(key managementAPIClientKey, newClient func() (*apigatewaymanagementapi.Client, error)) (*apigatewaymanagementapi.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if client, ok := c.clients[key]; ok {
+		return client, nil
+	}
+	client, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	c.clients[key] = client
+	return client, nil
+}
+
+// CallbackURL returns the callback URL (endpoint of @connections API) of the API Gateway Websocket API stage.
+func CallbackURL(apiID, stage, region string) string {
+	return "https://" + apiID + ".execute-api." + region + ".amazonaws.com/" + stage
+}
+
+// regionFromEndpoint returns region from the default endpoint of API Gateway, like https://{api-id}.execute-api.{region}.amazonaws.com/{stage}.
+func regionFromEndpoint(endpoint string) (string, bool) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", false
+	}
+	parts := strings.Split(u.Hostname(), ".")
+	if len(parts) == 5 && parts[1] == "execute-api" && parts[3] == "amazonaws" && parts[4] == "com" {
+		return parts[2], true
+	}
+	return "", false
+}
+
+// resolveEndpoint returns the endpoint of @connections API and whether it is local bridge.
+//
+// outside of the request of API Gateway (for example, SQS consumer), the endpoint is callback URL in context.
+// it is treated as local bridge with dummy credentials, unless aws.Config is in context or the endpoint is default endpoint of API Gateway.
+func resolveEndpoint(ctx context.Context) (string, bool, error) {
 	callbackURL := callbackURLFromContext(ctx)
 	proxyCtx := ProxyRequestContext(ctx)
 	if proxyCtx.APIID == "" {
-		// for local with dummy credentials
-		region := os.Getenv("AWS_REGION")
-		if region == "" {
-			region = "us-east-1"
-		}
 		if callbackURL == "" {
-			return nil, errors.New("elevate: callbackURL is empty")
-		}
-		cfg := aws.Config{
-			Region: region,
-			Credentials: aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(
-				"AWS_ACCESS_KEY_ID",
-				"AWS_SECRET_ACCESS_KEY",
-				"AWS_SESSION_TOKEN",
-			)),
+			return "", false, errors.New("elevate: callbackURL is empty")
 		}
-		return apigatewaymanagementapi.NewFromConfig(cfg, func(o *apigatewaymanagementapi.Options) {
-			o.BaseEndpoint = &callbackURL
-		}), nil
+		_, hasConfig := lookupAWSConfig(ctx)
+		_, isAWS := regionFromEndpoint(callbackURL)
+		return callbackURL, !hasConfig && !isAWS, nil
 	}
-	awsConfig := awsConfigFromContext(ctx)
 	if callbackURL == "" {
 		if strings.HasPrefix(proxyCtx.DomainName, proxyCtx.APIID) &&
 			strings.HasSuffix(proxyCtx.DomainName, "amazonaws.com") &&
 			proxyCtx.Stage != "" {
 			callbackURL = "https://" + proxyCtx.DomainName + "/" + proxyCtx.Stage
 		} else {
-			callbackURL = "https://" + proxyCtx.APIID + ".execute-api." + awsConfig.Region + ".amazonaws.com/" + proxyCtx.Stage
+			callbackURL = CallbackURL(proxyCtx.APIID, proxyCtx.Stage, awsConfigFromContext(ctx).Region)
 		}
 	}
-	return apigatewaymanagementapi.NewFromConfig(awsConfig, func(o *apigatewaymanagementapi.Options) {
-		o.BaseEndpoint = aws.String(callbackURL)
+	return callbackURL, false, nil
+}
+
+func newManagementAPIClient(ctx context.Context, endpoint string, local bool) (*apigatewaymanagementapi.Client, error) {
+	var cfg aws.Config
+	if local {
+		// for local with dummy credentials
+		cfg = aws.Config{
+			Region: localRegion(),
+			Credentials: aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(
+				LocalCredentials.AccessKeyID,
+				LocalCredentials.SecretAccessKey,
+				LocalCredentials.SessionToken,
+			)),
+		}
+	} else {
+		var ok bool
+		cfg, ok = lookupAWSConfig(ctx)
+		if !ok {
+			var err error
+			cfg, err = config.LoadDefaultConfig(ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if region, ok := regionFromEndpoint(endpoint); ok {
+			cfg.Region = region
+		}
+	}
+	return apigatewaymanagementapi.NewFromConfig(cfg, func(o *apigatewaymanagementapi.Options) {
+		o.BaseEndpoint = aws.String(endpoint)
+		if client := localHTTPClient(endpoint); client != nil {
+			o.HTTPClient = client
+		}
 	}), nil
 }
 
+// NewManagementAPIClient returns new @connections API client for the API of the request context.
+// in most cases, use ManagementClient instead, it returns cached client.
+func NewManagementAPIClient(ctx context.Context) (*apigatewaymanagementapi.Client, error) {
+	endpoint, local, err := resolveEndpoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newManagementAPIClient(ctx, endpoint, local)
+}
+
+// NewManagementAPIClientFor returns new @connections API client for the API Gateway Websocket API stage.
+// it can be used outside of the request of API Gateway, for example SQS consumer or scheduled Lambda function.
+// it uses aws.Config in context if exists, otherwise loads default config.
+func NewManagementAPIClientFor(ctx context.Context, apiID, stage, region string) (*apigatewaymanagementapi.Client, error) {
+	return newManagementAPIClient(ctx, CallbackURL(apiID, stage, region), false)
+}
+
+// ManagementClient returns @connections API client for the API of the request context.
+// if the client is injected by WithManagementAPIClient or ContextWithManagementAPIClient, it returns the injected client.
+// otherwise, it returns the client cached by endpoint and aws.Config in context (region and credentials provider), it is safe for concurrent use.
+func ManagementClient(ctx context.Context) (ManagementAPIClient, error) {
+	if client := managementAPIClientFromContext(ctx); client != nil {
+		return client, nil
+	}
+	endpoint, local, err := resolveEndpoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := managementAPIClientKey{
+		endpoint: endpoint,
+		local:    local,
+	}
+	if cfg, ok := lookupAWSConfig(ctx); ok && !local {
+		key.region = cfg.Region
+		key.credentials = cfg.Credentials
+		if cfg.Credentials != nil && !reflect.ValueOf(cfg.Credentials).Comparable() {
+			// the credentials provider can not be a key, for example aws.CredentialsProviderFunc.
+			return newManagementAPIClient(ctx, endpoint, local)
+		}
+	}
+	return clientCache.get(key, func() (*apigatewaymanagementapi.Client, error) {
+		return newManagementAPIClient(ctx, endpoint, local)
+	})
+}
+
 // PostToConnection posts data to connectionID.
+// if the connection is gone and ConnectionStoreHandler is used, the connection is pruned from ConnectionStore.
 func PostToConnection(ctx context.Context, connectionID string, data []byte) error {
-	client, err := NewManagementAPIClient(ctx)
+	client, err := ManagementClient(ctx)
 	if err != nil {
 		return err
 	}
@@ -61,12 +199,13 @@ func PostToConnection(ctx context.Context, connectionID string, data []byte) err
 		ConnectionId: aws.String(connectionID),
 		Data:         data,
 	})
+	pruneGoneConnection(ctx, connectionID, err)
 	return err
 }
 
 // DeleteConnection deletes connectionID.
 func DeleteConnection(ctx context.Context, connectionID string) error {
-	client, err := NewManagementAPIClient(ctx)
+	client, err := ManagementClient(ctx)
 	if err != nil {
 		return err
 	}
@@ -78,7 +217,7 @@ func DeleteConnection(ctx context.Context, connectionID string) error {
 
 // GetConnection gets connectionID.
 func GetConnection(ctx context.Context, connectionID string) (*apigatewaymanagementapi.GetConnectionOutput, error) {
-	client, err := NewManagementAPIClient(ctx)
+	client, err := ManagementClient(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,155 @@
+package elevate_test
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi"
+	"github.com/mashiike/elevate"
+)
+
+type stubManagementAPIClient struct {
+	mu    sync.Mutex
+	posts map[string][]byte
+}
+
+func (c *stubManagementAPIClient) PostToConnection(ctx context.Context, params *apigatewaymanagementapi.PostToConnectionInput, optFns ...func(*apigatewaymanagementapi.Options)) (*apigatewaymanagementapi.PostToConnectionOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.posts[aws.ToString(params.ConnectionId)] = params.Data
+	return &apigatewaymanagementapi.PostToConnectionOutput{}, nil
+}
+
+func (c *stubManagementAPIClient) DeleteConnection(ctx context.Context, params *apigatewaymanagementapi.DeleteConnectionInput, optFns ...func(*apigatewaymanagementapi.Options)) (*apigatewaymanagementapi.DeleteConnectionOutput, error) {
+	return &apigatewaymanagementapi.DeleteConnectionOutput{}, nil
+}
+
+func (c *stubManagementAPIClient) GetConnection(ctx context.Context, params *apigatewaymanagementapi.GetConnectionInput, optFns ...func(*apigatewaymanagementapi.Options)) (*apigatewaymanagementapi.GetConnectionOutput, error) {
+	return &apigatewaymanagementapi.GetConnectionOutput{}, nil
+}
+
+func TestManagementClient__Cached(t *testing.T) {
+	bs, err := os.ReadFile("testdata/default.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req1, err := elevate.NewRequest(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req2, err := elevate.NewRequest(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client1, err := elevate.ManagementClient(req1.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client2, err := elevate.ManagementClient(req2.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client1 != client2 {
+		t.Error("ManagementClient() returns different clients for same endpoint")
+	}
+	newClient, err := elevate.NewManagementAPIClient(req1.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elevate.ManagementAPIClient(newClient) == client1 {
+		t.Error("NewManagementAPIClient() returns cached client")
+	}
+}
+
+func TestManagementClient__CachedByAWSConfig(t *testing.T) {
+	ctx := elevate.ContextWithCallbackURL(context.Background(), "https://abcdefghij.execute-api.ap-northeast-1.amazonaws.com/develop")
+	cfg1 := aws.Config{
+		Region:      "ap-northeast-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AKIAFIRST", "first-secret", ""),
+	}
+	cfg2 := aws.Config{
+		Region:      "ap-northeast-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AKIASECOND", "second-secret", ""),
+	}
+	client1, err := elevate.ManagementClient(elevate.ContextWithAWSConfig(ctx, cfg1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client2, err := elevate.ManagementClient(elevate.ContextWithAWSConfig(ctx, cfg2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client1 == client2 {
+		t.Error("ManagementClient() returns same client for different aws.Config")
+	}
+	creds, err := client2.(*apigatewaymanagementapi.Client).Options().Credentials.Retrieve(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID != "AKIASECOND" {
+		t.Errorf("AccessKeyID = %s; want AKIASECOND", creds.AccessKeyID)
+	}
+	client3, err := elevate.ManagementClient(elevate.ContextWithAWSConfig(ctx, cfg1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client1 != client3 {
+		t.Error("ManagementClient() returns different clients for same aws.Config")
+	}
+	funcCfg := aws.Config{
+		Region: "ap-northeast-1",
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKIAFUNC", SecretAccessKey: "func-secret"}, nil
+		}),
+	}
+	if _, err := elevate.ManagementClient(elevate.ContextWithAWSConfig(ctx, funcCfg)); err != nil {
+		t.Errorf("ManagementClient() with func credentials error = %v; want nil", err)
+	}
+}
+
+func TestManagementClient__Injected(t *testing.T) {
+	stub := &stubManagementAPIClient{posts: make(map[string][]byte)}
+	ctx := elevate.ContextWithManagementAPIClient(context.Background(), stub)
+	client, err := elevate.ManagementClient(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client != stub {
+		t.Error("ManagementClient() does not return injected client")
+	}
+	if err := elevate.PostToConnection(ctx, "AAAAAAAAAAAAAAA=", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	result, err := elevate.Broadcast(ctx, []string{"BBBBBBBBBBBBBBB=", "CCCCCCCCCCCCCCC="}, []byte("world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Delivered) != 2 {
+		t.Errorf("len(result.Delivered) = %d; want 2", len(result.Delivered))
+	}
+	if string(stub.posts["AAAAAAAAAAAAAAA="]) != "hello" {
+		t.Errorf("posted data = %s; want hello", stub.posts["AAAAAAAAAAAAAAA="])
+	}
+	if string(stub.posts["CCCCCCCCCCCCCCC="]) != "world" {
+		t.Errorf("posted data = %s; want world", stub.posts["CCCCCCCCCCCCCCC="])
+	}
+}
+
+func TestNewManagementAPIClientFor(t *testing.T) {
+	ctx := elevate.ContextWithAWSConfig(context.Background(), aws.Config{Region: "us-east-1"})
+	client, err := elevate.NewManagementAPIClientFor(ctx, "abcdefghij", "develop", "ap-northeast-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := client.Options()
+	if got := aws.ToString(opts.BaseEndpoint); got != "https://abcdefghij.execute-api.ap-northeast-1.amazonaws.com/develop" {
+		t.Errorf("BaseEndpoint = %s; want https://abcdefghij.execute-api.ap-northeast-1.amazonaws.com/develop", got)
+	}
+	if opts.Region != "ap-northeast-1" {
+		t.Errorf("Region = %s; want ap-northeast-1", opts.Region)
+	}
+}
@@ -0,0 +1,180 @@
+package elevate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	// DefaultOutboundQueueSize is a default number of outbound messages buffered per connection in local bridge.
+	DefaultOutboundQueueSize = 64
+	// DefaultWriteTimeout is a default timeout to write a message to the connection in local bridge.
+	DefaultWriteTimeout = 10 * time.Second
+	// DefaultIdleTimeout is a default idle timeout of the connection in local bridge, same as API Gateway.
+	DefaultIdleTimeout = 10 * time.Minute
+	// DefaultMaxConnectionDuration is a default maximum duration of the connection in local bridge, same as API Gateway.
+	DefaultMaxConnectionDuration = 2 * time.Hour
+	// DefaultMaxMessageSize is a default maximum size of inbound message and @connections POST payload in local bridge, same as API Gateway.
+	DefaultMaxMessageSize int64 = 128 * 1024
+)
+
+var (
+	errOutboundQueueFull = errors.New("elevate: outbound queue is full")
+	errConnWriterClosed  = errors.New("elevate: connection writer is closed")
+)
+
+type writeRequest struct {
+	messageType int
+	data        []byte
+	result      chan error
+}
+
+// connWriter serializes all writes to *websocket.Conn, gorilla/websocket does not support concurrent writers.
+//
+// messages are buffered in bounded queue and written by one goroutine.
+// if the queue is full, write blocks until the queue has space (back-pressure),
+// and fails with errOutboundQueueFull after write timeout, also when the peer does not read messages.
+// in the latter case, the connection is closed and isBroken reports true.
+type connWriter struct {
+	ws           *websocket.Conn
+	queue        chan writeRequest
+	done         chan struct{}
+	closeOnce    sync.Once
+	writeTimeout time.Duration
+	broken       atomic.Bool
+}
+
+func newConnWriter(ws *websocket.Conn, queueSize int, writeTimeout time.Duration) *connWriter {
+	if queueSize <= 0 {
+		queueSize = DefaultOutboundQueueSize
+	}
+	if writeTimeout <= 0 {
+		writeTimeout = DefaultWriteTimeout
+	}
+	w := &connWriter{
+		ws:           ws,
+		queue:        make(chan writeRequest, queueSize),
+		done:         make(chan struct{}),
+		writeTimeout: writeTimeout,
+	}
+	go w.run()
+	return w
+}
+
+func (w *connWriter) run() {
+	for {
+		select {
+		case <-w.done:
+			return
+		case req := <-w.queue:
+			req.result <- w.writeFrame(req.messageType, req.data)
+			if w.isBroken() {
+				// closed after the result is sent, the caller should receive errOutboundQueueFull.
+				w.ws.Close()
+				return
+			}
+		}
+	}
+}
+
+func (w *connWriter) writeFrame(messageType int, data []byte) error {
+	deadline := time.Now().Add(w.writeTimeout)
+	switch messageType {
+	case websocket.CloseMessage, websocket.PingMessage, websocket.PongMessage:
+		return w.ws.WriteControl(messageType, data, deadline)
+	}
+	if err := w.ws.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	if err := w.ws.WriteMessage(messageType, data); err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			// the peer does not read messages and socket buffers are full.
+			// gorilla/websocket fails all writes after write deadline, so the connection is closed.
+			w.broken.Store(true)
+			return fmt.Errorf("%w: %v", errOutboundQueueFull, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// write enqueues the message and waits until it is written to the connection.
+func (w *connWriter) write(ctx context.Context, messageType int, data []byte) error {
+	req := writeRequest{
+		messageType: messageType,
+		data:        data,
+		result:      make(chan error, 1),
+	}
+	timer := time.NewTimer(w.writeTimeout)
+	defer timer.Stop()
+	select {
+	case w.queue <- req:
+	case <-w.done:
+		return errConnWriterClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return errOutboundQueueFull
+	}
+	select {
+	case err := <-req.result:
+		return err
+	case <-w.done:
+		select {
+		case err := <-req.result:
+			return err
+		default:
+		}
+		return errConnWriterClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isBroken reports whether the connection is closed by write timeout.
+func (w *connWriter) isBroken() bool {
+	return w.broken.Load()
+}
+
+// writeClose enqueues close frame and waits until it is written to the connection.
+func (w *connWriter) writeClose(code int, reason string) error {
+	return w.write(context.Background(), websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+}
+
+// handlePing is a ping handler of *websocket.Conn, it writes pong frame through the queue.
+func (w *connWriter) handlePing(data string) error {
+	// same as default ping handler, errors of pong are ignored.
+	w.write(context.Background(), websocket.PongMessage, []byte(data))
+	return nil
+}
+
+// keepalive sends ping frame every interval until the writer is closed.
+func (w *connWriter) keepalive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			if err := w.write(context.Background(), websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// close stops the writer goroutine, queued messages are discarded.
+func (w *connWriter) close() {
+	w.closeOnce.Do(func() {
+		close(w.done)
+	})
+}
@@ -0,0 +1,322 @@
+package elevate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrConnectionNotFound is returned by ConnectionStore.Get when the connection is not registered.
+var ErrConnectionNotFound = errors.New("elevate: connection not found")
+
+// Connection represents a websocket connection registered to ConnectionStore.
+type Connection struct {
+	ConnectionID string            `json:"connection_id"`
+	ConnectedAt  time.Time         `json:"connected_at"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+}
+
+func (c *Connection) clone() *Connection {
+	cloned := *c
+	if c.Attributes != nil {
+		cloned.Attributes = make(map[string]string, len(c.Attributes))
+		for k, v := range c.Attributes {
+			cloned.Attributes[k] = v
+		}
+	}
+	return &cloned
+}
+
+func (c *Connection) matchAttributes(attrs map[string]string) bool {
+	for k, v := range attrs {
+		if got, ok := c.Attributes[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ConnectionStore is a registry of websocket connections.
+type ConnectionStore interface {
+	// Put registers the connection, if already registered, it is overwritten.
+	Put(ctx context.Context, conn *Connection) error
+	// Delete deregisters the connection, it is not error if the connection is not registered.
+	Delete(ctx context.Context, connectionID string) error
+	// Get returns the connection, if not registered, returns ErrConnectionNotFound.
+	Get(ctx context.Context, connectionID string) (*Connection, error)
+	// List returns all registered connections.
+	List(ctx context.Context) ([]*Connection, error)
+	// Scan returns registered connections that have all of given attributes.
+	Scan(ctx context.Context, attrs map[string]string) ([]*Connection, error)
+}
+
+// ConnectionStoreHandler is a http.Handler that registers connections to ConnectionStore automatically.
+//
+// it registers the connection on $connect when the handler responds 200 OK, and deregisters it after $disconnect handler.
+// ConnectionStore is set to request context, PostToConnection and Broadcast prune the connection when the connection is gone.
+type ConnectionStoreHandler struct {
+	Handler        http.Handler
+	store          ConnectionStore
+	attributesFunc func(*http.Request) map[string]string
+	logger         *slog.Logger
+}
+
+// NewConnectionStoreHandler returns ConnectionStoreHandler.
+func NewConnectionStoreHandler(store ConnectionStore, handler http.Handler) *ConnectionStoreHandler {
+	return &ConnectionStoreHandler{
+		Handler: handler,
+		store:   store,
+		logger:  slog.Default(),
+	}
+}
+
+// SetAttributesFunc sets a function to build attributes of the connection from $connect request.
+func (h *ConnectionStoreHandler) SetAttributesFunc(f func(*http.Request) map[string]string) {
+	h.attributesFunc = f
+}
+
+func (h *ConnectionStoreHandler) SetLogger(logger *slog.Logger) {
+	h.logger = logger
+}
+
+func (h *ConnectionStoreHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := contextWithConnectionStore(req.Context(), h.store)
+	req = req.WithContext(ctx)
+	switch RouteKey(req) {
+	case RouteKeyConnect:
+		sw := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		h.Handler.ServeHTTP(sw, req)
+		if sw.statusCode != http.StatusOK {
+			return
+		}
+		conn := &Connection{
+			ConnectionID: ConnectionID(req),
+			ConnectedAt:  ConnectedAt(req),
+		}
+		if conn.ConnectedAt.IsZero() {
+			conn.ConnectedAt = time.Now()
+		}
+		if h.attributesFunc != nil {
+			conn.Attributes = h.attributesFunc(req)
+		}
+		if err := h.store.Put(ctx, conn); err != nil {
+			h.logger.ErrorContext(ctx, "failed to put connection", "detail", err, "connection_id", conn.ConnectionID)
+		}
+	case RouteKeyDisconnect:
+		h.Handler.ServeHTTP(w, req)
+		if err := h.store.Delete(ctx, ConnectionID(req)); err != nil {
+			h.logger.ErrorContext(ctx, "failed to delete connection", "detail", err, "connection_id", ConnectionID(req))
+		}
+	default:
+		h.Handler.ServeHTTP(w, req)
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.statusCode = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// pruneGoneConnection deletes the connection from ConnectionStore in context, if err is GoneException.
+func pruneGoneConnection(ctx context.Context, connectionID string, err error) {
+	if !ConnectionIsGone(err) {
+		return
+	}
+	store := connectionStoreFromContext(ctx)
+	if store == nil {
+		return
+	}
+	if err := store.Delete(ctx, connectionID); err != nil {
+		slog.WarnContext(ctx, "failed to prune gone connection", "detail", err, "connection_id", connectionID)
+	}
+}
+
+// InMemoryConnectionStore is a ConnectionStore on memory. for local and testing.
+type InMemoryConnectionStore struct {
+	mu          sync.RWMutex
+	connections map[string]*Connection
+}
+
+// NewInMemoryConnectionStore returns InMemoryConnectionStore.
+func NewInMemoryConnectionStore() *InMemoryConnectionStore {
+	return &InMemoryConnectionStore{
+		connections: make(map[string]*Connection),
+	}
+}
+
+func (s *InMemoryConnectionStore) Put(_ context.Context, conn *Connection) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connections[conn.ConnectionID] = conn.clone()
+	return nil
+}
+
+func (s *InMemoryConnectionStore) Delete(_ context.Context, connectionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.connections, connectionID)
+	return nil
+}
+
+func (s *InMemoryConnectionStore) Get(_ context.Context, connectionID string) (*Connection, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	conn, ok := s.connections[connectionID]
+	if !ok {
+		return nil, ErrConnectionNotFound
+	}
+	return conn.clone(), nil
+}
+
+func (s *InMemoryConnectionStore) List(ctx context.Context) ([]*Connection, error) {
+	return s.Scan(ctx, nil)
+}
+
+func (s *InMemoryConnectionStore) Scan(_ context.Context, attrs map[string]string) ([]*Connection, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return scanConnections(s.connections, attrs), nil
+}
+
+func scanConnections(connections map[string]*Connection, attrs map[string]string) []*Connection {
+	ret := make([]*Connection, 0, len(connections))
+	for _, conn := range connections {
+		if conn.matchAttributes(attrs) {
+			ret = append(ret, conn.clone())
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].ConnectionID < ret[j].ConnectionID
+	})
+	return ret
+}
+
+// FileConnectionStore is a ConnectionStore on JSON file. for local development.
+// connections are kept across restart of the local server.
+type FileConnectionStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileConnectionStore returns FileConnectionStore, the file is created if not exists.
+func NewFileConnectionStore(path string) (*FileConnectionStore, error) {
+	s := &FileConnectionStore{
+		path: path,
+	}
+	if _, err := os.Stat(path); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err := s.save(map[string]*Connection{}); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *FileConnectionStore) load() (map[string]*Connection, error) {
+	bs, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	connections := make(map[string]*Connection)
+	if len(bs) == 0 {
+		return connections, nil
+	}
+	if err := json.Unmarshal(bs, &connections); err != nil {
+		return nil, err
+	}
+	return connections, nil
+}
+
+func (s *FileConnectionStore) save(connections map[string]*Connection) error {
+	bs, err := json.MarshalIndent(connections, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bs); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func (s *FileConnectionStore) update(f func(map[string]*Connection)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	connections, err := s.load()
+	if err != nil {
+		return err
+	}
+	f(connections)
+	return s.save(connections)
+}
+
+func (s *FileConnectionStore) Put(_ context.Context, conn *Connection) error {
+	return s.update(func(connections map[string]*Connection) {
+		connections[conn.ConnectionID] = conn.clone()
+	})
+}
+
+func (s *FileConnectionStore) Delete(_ context.Context, connectionID string) error {
+	return s.update(func(connections map[string]*Connection) {
+		delete(connections, connectionID)
+	})
+}
+
+func (s *FileConnectionStore) Get(_ context.Context, connectionID string) (*Connection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	connections, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	conn, ok := connections[connectionID]
+	if !ok {
+		return nil, ErrConnectionNotFound
+	}
+	return conn, nil
+}
+
+func (s *FileConnectionStore) List(ctx context.Context) ([]*Connection, error) {
+	return s.Scan(ctx, nil)
+}
+
+func (s *FileConnectionStore) Scan(_ context.Context, attrs map[string]string) ([]*Connection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	connections, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return scanConnections(connections, attrs), nil
+}
@@ -0,0 +1,182 @@
+package elevate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	dynamoDBAttrConnectionID = "connection_id"
+	dynamoDBAttrConnectedAt  = "connected_at"
+	dynamoDBAttrAttributes   = "attributes"
+)
+
+// DynamoDBConnectionStore is a ConnectionStore on DynamoDB table.
+//
+// the table must have partition key `connection_id` (String).
+// each item has `connected_at` (Number, unix milliseconds) and `attributes` (Map of String).
+// it can be used with DynamoDB Local by setting BaseEndpoint of dynamodb.Client.
+type DynamoDBConnectionStore struct {
+	client    *dynamodb.Client
+	tableName string
+}
+
+// NewDynamoDBConnectionStore returns DynamoDBConnectionStore.
+func NewDynamoDBConnectionStore(client *dynamodb.Client, tableName string) *DynamoDBConnectionStore {
+	return &DynamoDBConnectionStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// CreateTable creates the table for DynamoDBConnectionStore with on-demand capacity. for local and testing.
+func (s *DynamoDBConnectionStore) CreateTable(ctx context.Context) error {
+	_, err := s.client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String(s.tableName),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String(dynamoDBAttrConnectionID),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String(dynamoDBAttrConnectionID),
+				KeyType:       types.KeyTypeHash,
+			},
+		},
+		BillingMode: types.BillingModePayPerRequest,
+	})
+	return err
+}
+
+func (s *DynamoDBConnectionStore) Put(ctx context.Context, conn *Connection) error {
+	item := map[string]types.AttributeValue{
+		dynamoDBAttrConnectionID: &types.AttributeValueMemberS{Value: conn.ConnectionID},
+		dynamoDBAttrConnectedAt:  &types.AttributeValueMemberN{Value: strconv.FormatInt(conn.ConnectedAt.UnixMilli(), 10)},
+	}
+	if len(conn.Attributes) > 0 {
+		attrs := make(map[string]types.AttributeValue, len(conn.Attributes))
+		for k, v := range conn.Attributes {
+			attrs[k] = &types.AttributeValueMemberS{Value: v}
+		}
+		item[dynamoDBAttrAttributes] = &types.AttributeValueMemberM{Value: attrs}
+	}
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item:      item,
+	})
+	return err
+}
+
+func (s *DynamoDBConnectionStore) Delete(ctx context.Context, connectionID string) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			dynamoDBAttrConnectionID: &types.AttributeValueMemberS{Value: connectionID},
+		},
+	})
+	return err
+}
+
+func (s *DynamoDBConnectionStore) Get(ctx context.Context, connectionID string) (*Connection, error) {
+	output, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			dynamoDBAttrConnectionID: &types.AttributeValueMemberS{Value: connectionID},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if output.Item == nil {
+		return nil, ErrConnectionNotFound
+	}
+	return decodeDynamoDBConnection(output.Item)
+}
+
+func (s *DynamoDBConnectionStore) List(ctx context.Context) ([]*Connection, error) {
+	return s.Scan(ctx, nil)
+}
+
+func (s *DynamoDBConnectionStore) Scan(ctx context.Context, attrs map[string]string) ([]*Connection, error) {
+	input := &dynamodb.ScanInput{
+		TableName:      aws.String(s.tableName),
+		ConsistentRead: aws.Bool(true),
+	}
+	if len(attrs) > 0 {
+		keys := make([]string, 0, len(attrs))
+		for k := range attrs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		conditions := make([]string, 0, len(keys))
+		input.ExpressionAttributeNames = map[string]string{
+			"#attrs": dynamoDBAttrAttributes,
+		}
+		input.ExpressionAttributeValues = make(map[string]types.AttributeValue, len(keys))
+		for i, k := range keys {
+			name := fmt.Sprintf("#k%d", i)
+			value := fmt.Sprintf(":v%d", i)
+			input.ExpressionAttributeNames[name] = k
+			input.ExpressionAttributeValues[value] = &types.AttributeValueMemberS{Value: attrs[k]}
+			conditions = append(conditions, "#attrs."+name+" = "+value)
+		}
+		input.FilterExpression = aws.String(strings.Join(conditions, " AND "))
+	}
+	var connections []*Connection
+	paginator := dynamodb.NewScanPaginator(s.client, input)
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range output.Items {
+			conn, err := decodeDynamoDBConnection(item)
+			if err != nil {
+				return nil, err
+			}
+			connections = append(connections, conn)
+		}
+	}
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].ConnectionID < connections[j].ConnectionID
+	})
+	return connections, nil
+}
+
+func decodeDynamoDBConnection(item map[string]types.AttributeValue) (*Connection, error) {
+	id, ok := item[dynamoDBAttrConnectionID].(*types.AttributeValueMemberS)
+	if !ok {
+		return nil, errors.New("elevate: invalid connection item, connection_id is missing")
+	}
+	conn := &Connection{
+		ConnectionID: id.Value,
+	}
+	if connectedAt, ok := item[dynamoDBAttrConnectedAt].(*types.AttributeValueMemberN); ok {
+		ms, err := strconv.ParseInt(connectedAt.Value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("elevate: invalid connection item, connected_at: %w", err)
+		}
+		conn.ConnectedAt = time.UnixMilli(ms)
+	}
+	if attrs, ok := item[dynamoDBAttrAttributes].(*types.AttributeValueMemberM); ok {
+		conn.Attributes = make(map[string]string, len(attrs.Value))
+		for k, v := range attrs.Value {
+			if s, ok := v.(*types.AttributeValueMemberS); ok {
+				conn.Attributes[k] = s.Value
+			}
+		}
+	}
+	return conn, nil
+}
@@ -0,0 +1,209 @@
+package elevate_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/gorilla/websocket"
+	"github.com/mashiike/elevate"
+)
+
+func testConnectionStore(t *testing.T, store elevate.ConnectionStore) {
+	t.Helper()
+	ctx := context.Background()
+	connectedAt := time.UnixMilli(1703610495030)
+	conns := []*elevate.Connection{
+		{ConnectionID: "AAAAAAAAAAAAAAA=", ConnectedAt: connectedAt, Attributes: map[string]string{"room": "abc", "role": "member"}},
+		{ConnectionID: "BBBBBBBBBBBBBBB=", ConnectedAt: connectedAt, Attributes: map[string]string{"room": "abc", "role": "owner"}},
+		{ConnectionID: "CCCCCCCCCCCCCCC=", ConnectedAt: connectedAt, Attributes: map[string]string{"room": "def"}},
+		{ConnectionID: "DDDDDDDDDDDDDDD=", ConnectedAt: connectedAt},
+	}
+	for _, conn := range conns {
+		if err := store.Put(ctx, conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := store.Get(ctx, "AAAAAAAAAAAAAAA=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.ConnectedAt.Equal(connectedAt) {
+		t.Errorf("ConnectedAt = %s; want %s", got.ConnectedAt, connectedAt)
+	}
+	if got.Attributes["room"] != "abc" {
+		t.Errorf("Attributes[room] = %s; want abc", got.Attributes["room"])
+	}
+	if _, err := store.Get(ctx, "ZZZZZZZZZZZZZZZ="); !errors.Is(err, elevate.ErrConnectionNotFound) {
+		t.Errorf("Get(not registered) error = %v; want ErrConnectionNotFound", err)
+	}
+	list, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 4 {
+		t.Errorf("len(List()) = %d; want 4", len(list))
+	}
+	cases := []struct {
+		attrs map[string]string
+		want  []string
+	}{
+		{attrs: map[string]string{"room": "abc"}, want: []string{"AAAAAAAAAAAAAAA=", "BBBBBBBBBBBBBBB="}},
+		{attrs: map[string]string{"room": "abc", "role": "owner"}, want: []string{"BBBBBBBBBBBBBBB="}},
+		{attrs: map[string]string{"room": "xyz"}, want: []string{}},
+	}
+	for _, c := range cases {
+		scanned, err := store.Scan(ctx, c.attrs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make([]string, 0, len(scanned))
+		for _, conn := range scanned {
+			ids = append(ids, conn.ConnectionID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(c.want) {
+			t.Errorf("Scan(%v) = %v; want %v", c.attrs, ids, c.want)
+		}
+	}
+	if err := store.Delete(ctx, "AAAAAAAAAAAAAAA="); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "AAAAAAAAAAAAAAA="); err != nil {
+		t.Errorf("Delete(already deleted) error = %v; want nil", err)
+	}
+	if _, err := store.Get(ctx, "AAAAAAAAAAAAAAA="); !errors.Is(err, elevate.ErrConnectionNotFound) {
+		t.Errorf("Get(deleted) error = %v; want ErrConnectionNotFound", err)
+	}
+}
+
+func TestInMemoryConnectionStore(t *testing.T) {
+	testConnectionStore(t, elevate.NewInMemoryConnectionStore())
+}
+
+func TestFileConnectionStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "connections.json")
+	store, err := elevate.NewFileConnectionStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testConnectionStore(t, store)
+
+	reopened, err := elevate.NewFileConnectionStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := reopened.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 {
+		t.Errorf("len(List()) after reopen = %d; want 3", len(list))
+	}
+}
+
+// TestDynamoDBConnectionStore runs against DynamoDB Local, set DYNAMODB_LOCAL_ENDPOINT (e.g. http://localhost:8000) to run.
+func TestDynamoDBConnectionStore(t *testing.T) {
+	endpoint := os.Getenv("DYNAMODB_LOCAL_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("DYNAMODB_LOCAL_ENDPOINT is not set")
+	}
+	client := dynamodb.NewFromConfig(aws.Config{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("dummy", "dummy", ""),
+	}, func(o *dynamodb.Options) {
+		o.BaseEndpoint = aws.String(endpoint)
+	})
+	ctx := context.Background()
+	tableName := fmt.Sprintf("elevate-test-%d", time.Now().UnixNano())
+	store := elevate.NewDynamoDBConnectionStore(client, tableName)
+	if err := store.CreateTable(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{
+			TableName: aws.String(tableName),
+		})
+	})
+	testConnectionStore(t, store)
+}
+
+func TestConnectionStoreHandler(t *testing.T) {
+	store := elevate.NewInMemoryConnectionStore()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := store.Put(ctx, &elevate.Connection{ConnectionID: "GONEGONEGONEGON="}); err != nil {
+		t.Fatal(err)
+	}
+	disconnected := make(chan string, 1)
+	mux := elevate.NewRouteMux()
+	mux.HandleDisconnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		disconnected <- elevate.ConnectionID(req)
+	}))
+	mux.HandleDefault(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conns, err := store.Scan(req.Context(), map[string]string{"room": "abc"})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		for _, conn := range conns {
+			fmt.Fprintln(w, conn.ConnectionID)
+		}
+		err = elevate.PostToConnection(req.Context(), "GONEGONEGONEGON=", []byte("hello"))
+		if !elevate.ConnectionIsGone(err) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}))
+	storeHandler := elevate.NewConnectionStoreHandler(store, mux)
+	storeHandler.SetAttributesFunc(func(req *http.Request) map[string]string {
+		return map[string]string{"room": req.URL.Query().Get("room")}
+	})
+	handler := elevate.NewWebsocketHTTPBridgeHandler(storeHandler)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	handler.SetCallbackURL(server.URL)
+
+	c, _, err := websocket.DefaultDialer.DialContext(ctx, "ws://"+server.Listener.Addr().String()+"/?room=abc", nil)
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	if err := c.WriteMessage(websocket.TextMessage, []byte(`hello`)); err != nil {
+		t.Fatal("write:", err)
+	}
+	_, message, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal("read:", err)
+	}
+	conns, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conns) != 1 {
+		t.Fatalf("len(List()) = %d; want 1, gone connection should be pruned", len(conns))
+	}
+	if string(message) != conns[0].ConnectionID+"\n" {
+		t.Errorf("unexpected message: `%s`", message)
+	}
+	c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	c.Close()
+	select {
+	case id := <-disconnected:
+		if id != conns[0].ConnectionID {
+			t.Errorf("disconnected connection id = %s; want %s", id, conns[0].ConnectionID)
+		}
+	case <-ctx.Done():
+		t.Fatal("$disconnect is not called")
+	}
+	if _, err := store.Get(ctx, conns[0].ConnectionID); !errors.Is(err, elevate.ErrConnectionNotFound) {
+		t.Errorf("Get(disconnected) error = %v; want ErrConnectionNotFound", err)
+	}
+}
@@ -0,0 +1,138 @@
+package elevate
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+const (
+	sigV4Algorithm          = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat         = "20060102T150405Z"
+	sigV4DateFormat         = "20060102"
+	sigV4MaxSkew            = 5 * time.Minute
+	sigV4Service            = "execute-api"
+	sigV4Terminator         = "aws4_request"
+	manageConnectionsAction = "execute-api:ManageConnections"
+)
+
+// ConnectionsAPIPrincipal is a principal allowed to call @connections API of local bridge.
+// it emulates IAM policy attached to the caller, Actions and Resources must be set explicitly.
+type ConnectionsAPIPrincipal struct {
+	// Credentials is used to verify SigV4 signature of the request.
+	Credentials aws.Credentials
+	// Actions is a list of allowed actions, for example `execute-api:ManageConnections` or `execute-api:*`.
+	Actions []string
+	// Resources is a list of allowed resources, for example `arn:aws:execute-api:*:*:*/*/POST/@connections/*`.
+	Resources []string
+}
+
+var errConnectionsPayloadTooLarge = errors.New("payload too large")
+
+// verifyConnectionsRequest verifies SigV4 signature and permission of @connections API request.
+func (h *WebsocketHTTPBridgeHandler) verifyConnectionsRequest(req *http.Request, stage string, connectionID string) error {
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, sigV4Algorithm+" ") {
+		return errors.New("missing authentication token")
+	}
+	fields := make(map[string]string, 3)
+	for _, field := range strings.Split(strings.TrimPrefix(auth, sigV4Algorithm+" "), ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(field), "=")
+		fields[k] = v
+	}
+	scope := strings.Split(fields["Credential"], "/")
+	if len(scope) != 5 || fields["SignedHeaders"] == "" || fields["Signature"] == "" {
+		return errors.New("malformed authorization header")
+	}
+	accessKeyID, date, region, service := scope[0], scope[1], scope[2], scope[3]
+	if service != sigV4Service || scope[4] != sigV4Terminator {
+		return fmt.Errorf("credential should be scoped to correct service: %s", sigV4Service)
+	}
+	if region != localRegion() {
+		return fmt.Errorf("credential should be scoped to a valid region: %s", localRegion())
+	}
+	var principal *ConnectionsAPIPrincipal
+	for i := range h.connectionsAPIPrincipals {
+		if h.connectionsAPIPrincipals[i].Credentials.AccessKeyID == accessKeyID {
+			principal = &h.connectionsAPIPrincipals[i]
+			break
+		}
+	}
+	if principal == nil {
+		return fmt.Errorf("unknown access key id %s", accessKeyID)
+	}
+	signingTime, err := time.Parse(sigV4TimeFormat, req.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return fmt.Errorf("invalid X-Amz-Date: %w", err)
+	}
+	if date != signingTime.Format(sigV4DateFormat) {
+		return errors.New("credential should be scoped to the date of X-Amz-Date")
+	}
+	if skew := time.Since(signingTime); skew > sigV4MaxSkew || skew < -sigV4MaxSkew {
+		return errors.New("signature expired")
+	}
+	if req.Header.Get("X-Amz-Security-Token") != principal.Credentials.SessionToken {
+		return errors.New("invalid security token")
+	}
+	var r io.Reader = req.Body
+	if h.maxMessageSize > 0 {
+		r = io.LimitReader(req.Body, h.maxMessageSize+1)
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	if h.maxMessageSize > 0 && int64(len(body)) > h.maxMessageSize {
+		// the signature can not be verified without whole payload.
+		return errConnectionsPayloadTooLarge
+	}
+	payloadHash := sha256.Sum256(body)
+
+	// re-sign the request with only signed headers, and compare the signature.
+	u := *req.URL
+	u.Scheme = "http"
+	u.Host = req.Host
+	signReq, err := http.NewRequest(req.Method, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	signReq.URL = &u
+	signReq.Host = req.Host
+	for _, name := range strings.Split(fields["SignedHeaders"], ";") {
+		switch name {
+		case "host":
+		case "content-length":
+			signReq.ContentLength = req.ContentLength
+		default:
+			signReq.Header[http.CanonicalHeaderKey(name)] = req.Header.Values(name)
+		}
+	}
+	signer := v4.NewSigner()
+	err = signer.SignHTTP(context.Background(), principal.Credentials, signReq, hex.EncodeToString(payloadHash[:]), service, region, signingTime)
+	if err != nil {
+		return err
+	}
+	expected := signReq.Header.Get("Authorization")
+	expected = expected[strings.LastIndex(expected, "Signature=")+len("Signature="):]
+	if !hmac.Equal([]byte(expected), []byte(fields["Signature"])) {
+		return errors.New("signature does not match")
+	}
+
+	resource := localMethodArn(stage, req.Method+"/@connections/"+connectionID)
+	if !matchAny(principal.Actions, manageConnectionsAction) || !matchAny(principal.Resources, resource) {
+		return fmt.Errorf("%s is not authorized to perform: %s on resource: %s", accessKeyID, manageConnectionsAction, resource)
+	}
+	return nil
+}
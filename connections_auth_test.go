@@ -0,0 +1,160 @@
+package elevate_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/smithy-go"
+	"github.com/gorilla/websocket"
+	"github.com/mashiike/elevate"
+)
+
+func TestWebsocketHTTPBridgeHandler__ConnectionsAPIPrincipals(t *testing.T) {
+	t.Setenv("AWS_REGION", "us-east-1")
+	connected := make(chan string, 1)
+	mux := elevate.NewRouteMux()
+	mux.HandleConnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		connected <- elevate.ConnectionID(req)
+	}))
+	handler := elevate.NewWebsocketHTTPBridgeHandler(mux)
+	handler.SetConnectionsAPIPrincipals(
+		elevate.ConnectionsAPIPrincipal{
+			Credentials: aws.Credentials{AccessKeyID: "AKIAWORKER", SecretAccessKey: "worker-secret"},
+			Actions:     []string{"execute-api:ManageConnections"},
+			Resources:   []string{"arn:aws:execute-api:*:*:*/*/POST/@connections/*"},
+		},
+		elevate.ConnectionsAPIPrincipal{
+			Credentials: aws.Credentials{AccessKeyID: "AKIAREADONLY", SecretAccessKey: "readonly-secret"},
+			Actions:     []string{"execute-api:Invoke"},
+			Resources:   []string{"*"},
+		},
+	)
+	handler.SetMaxMessageSize(1024)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	handler.SetCallbackURL(server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, _, err := websocket.DefaultDialer.DialContext(ctx, "ws://"+server.Listener.Addr().String()+"/", nil)
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	defer c.Close()
+	connectionID := <-connected
+
+	withRegionalCredentials := func(region, key, secret string) context.Context {
+		cfg := aws.Config{
+			Region:      region,
+			Credentials: credentials.NewStaticCredentialsProvider(key, secret, ""),
+		}
+		return elevate.ContextWithCallbackURL(elevate.ContextWithAWSConfig(ctx, cfg), server.URL)
+	}
+	withCredentials := func(key, secret string) context.Context {
+		return withRegionalCredentials("us-east-1", key, secret)
+	}
+	cases := []struct {
+		name      string
+		ctx       context.Context
+		forbidden bool
+	}{
+		{name: "allowed", ctx: withCredentials("AKIAWORKER", "worker-secret")},
+		{name: "invalid_signature", ctx: withCredentials("AKIAWORKER", "wrong-secret"), forbidden: true},
+		{name: "unknown_access_key", ctx: withCredentials("AKIAUNKNOWN", "worker-secret"), forbidden: true},
+		{name: "action_not_allowed", ctx: withCredentials("AKIAREADONLY", "readonly-secret"), forbidden: true},
+		{name: "dummy_credentials", ctx: elevate.ContextWithCallbackURL(ctx, server.URL), forbidden: true},
+		{name: "wrong_region", ctx: withRegionalCredentials("ap-northeast-1", "AKIAWORKER", "worker-secret"), forbidden: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := elevate.PostToConnection(tc.ctx, connectionID, []byte("hello"))
+			if !tc.forbidden {
+				if err != nil {
+					t.Fatalf("PostToConnection() error = %v; want nil", err)
+				}
+				if _, message, err := c.ReadMessage(); err != nil || string(message) != "hello" {
+					t.Errorf("read = %s, %v; want hello", message, err)
+				}
+				return
+			}
+			var apiErr smithy.APIError
+			if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "ForbiddenException" {
+				t.Errorf("PostToConnection() error = %v; want ForbiddenException", err)
+			}
+		})
+	}
+	if err := elevate.DeleteConnection(withCredentials("AKIAWORKER", "worker-secret"), connectionID); err == nil {
+		t.Error("DeleteConnection() succeeded; want ForbiddenException, only POST is allowed")
+	}
+	t.Run("wrong_service", func(t *testing.T) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/@connections/"+connectionID, strings.NewReader("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		payloadHash := sha256.Sum256([]byte("hello"))
+		creds := aws.Credentials{AccessKeyID: "AKIAWORKER", SecretAccessKey: "worker-secret"}
+		if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(payloadHash[:]), "s3", "us-east-1", time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("status = %d; want %d", resp.StatusCode, http.StatusForbidden)
+		}
+	})
+	t.Run("payload_too_large", func(t *testing.T) {
+		err := elevate.PostToConnection(withCredentials("AKIAWORKER", "worker-secret"), connectionID, make([]byte, 2048))
+		var apiErr smithy.APIError
+		if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "PayloadTooLargeException" {
+			t.Errorf("PostToConnection() error = %v; want PayloadTooLargeException", err)
+		}
+	})
+}
+
+func TestWebsocketHTTPBridgeHandler__ConnectionsAPIPrincipalsLocalCredentials(t *testing.T) {
+	mux := elevate.NewRouteMux()
+	mux.HandleDefault(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := elevate.PostToConnection(req.Context(), elevate.ConnectionID(req), []byte("posted")); err != nil {
+			t.Errorf("PostToConnection() error = %v; want nil", err)
+		}
+		w.Write([]byte("ok"))
+	}))
+	handler := elevate.NewWebsocketHTTPBridgeHandler(mux)
+	handler.SetConnectionsAPIPrincipals(elevate.ConnectionsAPIPrincipal{
+		Credentials: elevate.LocalCredentials,
+		Actions:     []string{"execute-api:ManageConnections"},
+		Resources:   []string{"*"},
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	handler.SetCallbackURL(server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, _, err := websocket.DefaultDialer.DialContext(ctx, "ws://"+server.Listener.Addr().String()+"/", nil)
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	defer c.Close()
+	if err := c.WriteMessage(websocket.TextMessage, []byte("post")); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"posted", "ok"} {
+		if _, message, err := c.ReadMessage(); err != nil || string(message) != want {
+			t.Errorf("read = %s, %v; want %s", message, err, want)
+		}
+	}
+}
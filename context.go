@@ -10,23 +10,54 @@ import (
 type contextKey string
 
 var (
-	reqContextKey         = contextKey("elevate.RequestContext")
-	awsConfigContextKey   = contextKey("elevate.awsConfig")
-	callbackURLContextKey = contextKey("elevate.callbackURL")
+	reqContextKey              = contextKey("elevate.RequestContext")
+	awsConfigContextKey        = contextKey("elevate.awsConfig")
+	callbackURLContextKey      = contextKey("elevate.callbackURL")
+	stageVarsContextKey        = contextKey("elevate.stageVariables")
+	queryParamsContextKey      = contextKey("elevate.queryStringParameters")
+	connStoreContextKey        = contextKey("elevate.connectionStore")
+	mgmtClientContextKey       = contextKey("elevate.managementAPIClient")
+	disconnectStatusContextKey = contextKey("elevate.disconnectStatus")
 )
 
 func contextWithRequestContext(ctx context.Context, reqCtx events.APIGatewayWebsocketProxyRequestContext) context.Context {
 	return context.WithValue(ctx, reqContextKey, reqCtx)
 }
 
-func contextWithAWSConfig(ctx context.Context, cfg aws.Config) context.Context {
+// ContextWithAWSConfig returns context with aws.Config, it is used by @connections API client.
+func ContextWithAWSConfig(ctx context.Context, cfg aws.Config) context.Context {
 	return context.WithValue(ctx, awsConfigContextKey, cfg)
 }
 
-func contextWithCallbackURL(ctx context.Context, url string) context.Context {
+// ContextWithCallbackURL returns context with callback URL, it is the endpoint of @connections API.
+// it is used to post to connections outside of the request of API Gateway, for example SQS consumer.
+// for AWS, use elevate.CallbackURL(apiID, stage, region). for local, use the address of local bridge, like http://localhost:8080.
+func ContextWithCallbackURL(ctx context.Context, url string) context.Context {
 	return context.WithValue(ctx, callbackURLContextKey, url)
 }
 
+func contextWithStageVariables(ctx context.Context, stageVars map[string]string) context.Context {
+	return context.WithValue(ctx, stageVarsContextKey, stageVars)
+}
+
+func contextWithQueryStringParameters(ctx context.Context, params map[string][]string) context.Context {
+	return context.WithValue(ctx, queryParamsContextKey, params)
+}
+
+func contextWithDisconnectStatus(ctx context.Context, status DisconnectStatus) context.Context {
+	return context.WithValue(ctx, disconnectStatusContextKey, status)
+}
+
+func contextWithConnectionStore(ctx context.Context, store ConnectionStore) context.Context {
+	return context.WithValue(ctx, connStoreContextKey, store)
+}
+
+// ContextWithManagementAPIClient returns context with ManagementAPIClient.
+// PostToConnection, DeleteConnection, GetConnection and Broadcast use the client in the context.
+func ContextWithManagementAPIClient(ctx context.Context, client ManagementAPIClient) context.Context {
+	return context.WithValue(ctx, mgmtClientContextKey, client)
+}
+
 func ProxyRequestContext(ctx context.Context) events.APIGatewayWebsocketProxyRequestContext {
 	if ctx == nil {
 		return events.APIGatewayWebsocketProxyRequestContext{}
@@ -38,13 +69,18 @@ func ProxyRequestContext(ctx context.Context) events.APIGatewayWebsocketProxyReq
 }
 
 func awsConfigFromContext(ctx context.Context) aws.Config {
+	cfg, _ := lookupAWSConfig(ctx)
+	return cfg
+}
+
+func lookupAWSConfig(ctx context.Context) (aws.Config, bool) {
 	if ctx == nil {
-		return aws.Config{}
+		return aws.Config{}, false
 	}
 	if v, ok := ctx.Value(awsConfigContextKey).(aws.Config); ok {
-		return v
+		return v, true
 	}
-	return aws.Config{}
+	return aws.Config{}, false
 }
 
 func callbackURLFromContext(ctx context.Context) string {
@@ -56,3 +92,53 @@ func callbackURLFromContext(ctx context.Context) string {
 	}
 	return ""
 }
+
+func stageVariablesFromContext(ctx context.Context) map[string]string {
+	if ctx == nil {
+		return nil
+	}
+	if v, ok := ctx.Value(stageVarsContextKey).(map[string]string); ok {
+		return v
+	}
+	return nil
+}
+
+func queryStringParametersFromContext(ctx context.Context) map[string][]string {
+	if ctx == nil {
+		return nil
+	}
+	if v, ok := ctx.Value(queryParamsContextKey).(map[string][]string); ok {
+		return v
+	}
+	return nil
+}
+
+func disconnectStatusFromContext(ctx context.Context) DisconnectStatus {
+	if ctx == nil {
+		return DisconnectStatus{}
+	}
+	if v, ok := ctx.Value(disconnectStatusContextKey).(DisconnectStatus); ok {
+		return v
+	}
+	return DisconnectStatus{}
+}
+
+func connectionStoreFromContext(ctx context.Context) ConnectionStore {
+	if ctx == nil {
+		return nil
+	}
+	if v, ok := ctx.Value(connStoreContextKey).(ConnectionStore); ok {
+		return v
+	}
+	return nil
+}
+
+func managementAPIClientFromContext(ctx context.Context) ManagementAPIClient {
+	if ctx == nil {
+		return nil
+	}
+	if v, ok := ctx.Value(mgmtClientContextKey).(ManagementAPIClient); ok {
+		return v
+	}
+	return nil
+}
@@ -3,6 +3,8 @@ package elevate
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -139,6 +141,24 @@ type runOptions struct {
 	callbackURL      string
 	logger           *slog.Logger
 	routeKeySelector RouteKeySelector
+	authorizer       Authorizer
+	routeResponses   map[string]bool
+	noRouteResponse  bool
+	mgmtClient       ManagementAPIClient
+	idleTimeout      time.Duration
+	maxDuration      time.Duration
+	pingInterval     time.Duration
+	maxMessageSize   int64
+	principals       []ConnectionsAPIPrincipal
+	tlsCertFile      string
+	tlsKeyFile       string
+	selfSignedTLS    bool
+	allowedOrigins   []string
+	checkOrigin      func(r *http.Request) bool
+	stages           map[string]map[string]string
+	recordFile       string
+	inProcessLambda  bool
+	rieEndpoint      string
 	varbose          bool
 }
 
@@ -148,6 +168,9 @@ func defaultRunOptions() runOptions {
 		runCtx:           context.Background(),
 		logger:           slog.Default(),
 		routeKeySelector: DefaultRouteKeySelector,
+		idleTimeout:      DefaultIdleTimeout,
+		maxDuration:      DefaultMaxConnectionDuration,
+		maxMessageSize:   DefaultMaxMessageSize,
 	}
 }
 
@@ -179,7 +202,159 @@ func WithRouteKeySelector(selector RouteKeySelector) Option {
 	}
 }
 
-// WithLambdaOptions sets lambda.Options to runOptions. only for AWS Lambda Runtime.
+// WithAuthorizer sets Authorizer for $connect route to runOptions. only for local.
+// on AWS, configure Lambda REQUEST authorizer to $connect route instead.
+func WithAuthorizer(authorizer Authorizer) Option {
+	return func(o *runOptions) {
+		o.authorizer = authorizer
+	}
+}
+
+// WithRouteResponse sets whether the integration response of the route is returned to the client. only for local.
+// on AWS, the integration response is returned only when route response is configured for the route.
+func WithRouteResponse(routeKey string, enabled bool) Option {
+	return func(o *runOptions) {
+		if o.routeResponses == nil {
+			o.routeResponses = make(map[string]bool)
+		}
+		o.routeResponses[routeKey] = enabled
+	}
+}
+
+// WithoutRouteResponse disables returning the integration response for routes not configured by WithRouteResponse. only for local.
+// it emulates API Gateway without route responses. default returns the integration response for all routes.
+func WithoutRouteResponse() Option {
+	return func(o *runOptions) {
+		o.noRouteResponse = true
+	}
+}
+
+// WithManagementAPIClient sets ManagementAPIClient to runOptions.
+// PostToConnection, DeleteConnection, GetConnection and Broadcast in handler use this client, for custom retryer or middlewares.
+func WithManagementAPIClient(client ManagementAPIClient) Option {
+	return func(o *runOptions) {
+		o.mgmtClient = client
+	}
+}
+
+// WithCallbackURL sets callback URL (endpoint of @connections API) to runOptions.
+// on AWS Lambda Runtime, default is resolved from request context. on local, default is the address of local httpd.
+func WithCallbackURL(callbackURL string) Option {
+	return func(o *runOptions) {
+		o.callbackURL = callbackURL
+	}
+}
+
+// WithIdleTimeout sets idle timeout of the connection to runOptions. only for local.
+// default is 10 minutes same as API Gateway, zero means no idle timeout.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(o *runOptions) {
+		o.idleTimeout = timeout
+	}
+}
+
+// WithMaxConnectionDuration sets maximum duration of the connection to runOptions. only for local.
+// default is 2 hours same as API Gateway, zero means no limit.
+func WithMaxConnectionDuration(duration time.Duration) Option {
+	return func(o *runOptions) {
+		o.maxDuration = duration
+	}
+}
+
+// WithPingInterval sets interval to send ping frame to the client to runOptions. only for local.
+// default is zero (disabled).
+func WithPingInterval(interval time.Duration) Option {
+	return func(o *runOptions) {
+		o.pingInterval = interval
+	}
+}
+
+// WithMaxMessageSize sets maximum size of inbound message and @connections POST payload to runOptions. only for local.
+// default is 128 KB same as API Gateway, zero means no limit.
+func WithMaxMessageSize(size int64) Option {
+	return func(o *runOptions) {
+		o.maxMessageSize = size
+	}
+}
+
+// WithConnectionsAPIPrincipals sets principals allowed to call @connections API to runOptions. only for local.
+// if set, @connections API verifies SigV4 signature and IAM permission, and responds 403 ForbiddenException on failure.
+func WithConnectionsAPIPrincipals(principals ...ConnectionsAPIPrincipal) Option {
+	return func(o *runOptions) {
+		o.principals = append(o.principals, principals...)
+	}
+}
+
+// WithTLS sets certificate and key files to runOptions, local httpd serves wss:// and https:// . only for local.
+// @connections API client in the same process trusts the certificate, for example the certificate for development.
+func WithTLS(certFile, keyFile string) Option {
+	return func(o *runOptions) {
+		o.tlsCertFile = certFile
+		o.tlsKeyFile = keyFile
+	}
+}
+
+// WithSelfSignedTLS sets runOptions to serve wss:// with in-memory self-signed certificate for localhost. only for local.
+// @connections API client in the same process trusts the certificate, other clients need to skip verification.
+func WithSelfSignedTLS() Option {
+	return func(o *runOptions) {
+		o.selfSignedTLS = true
+	}
+}
+
+// WithAllowedOrigins sets allowed origins of websocket upgrade to runOptions. only for local.
+// default allows same origin only. origin can contain wildcard `*` and `?`, for example `http://localhost:*`.
+func WithAllowedOrigins(origins ...string) Option {
+	return func(o *runOptions) {
+		o.allowedOrigins = append(o.allowedOrigins, origins...)
+	}
+}
+
+// WithCheckOrigin sets the function to check origin of websocket upgrade to runOptions. only for local.
+// it takes precedence over WithAllowedOrigins.
+func WithCheckOrigin(checkOrigin func(r *http.Request) bool) Option {
+	return func(o *runOptions) {
+		o.checkOrigin = checkOrigin
+	}
+}
+
+// WithStage adds the stage with stage variables to runOptions. only for local.
+// local httpd serves `ws://{address}/{stage}` and `/{stage}/@connections/{connectionId}` same as API Gateway,
+// and the callback URL of the request is `{callback URL}/{stage}`. it can be set multiple times for multiple stages.
+func WithStage(stage string, stageVariables map[string]string) Option {
+	return func(o *runOptions) {
+		if o.stages == nil {
+			o.stages = make(map[string]map[string]string)
+		}
+		o.stages[stage] = stageVariables
+	}
+}
+
+// WithRecordFile sets the file to record events and responses of local session as JSONL. only for local.
+// the file is appended, and can be replayed by Replay as regression test.
+func WithRecordFile(path string) Option {
+	return func(o *runOptions) {
+		o.recordFile = path
+	}
+}
+
+// WithInProcessLambda sets local httpd to invoke the handler through Lambda code path in the same process. only for local.
+// events are encoded as the payload of Lambda invocation, and decoded by the same handler as AWS Lambda Runtime.
+func WithInProcessLambda() Option {
+	return func(o *runOptions) {
+		o.inProcessLambda = true
+	}
+}
+
+// WithRuntimeInterfaceEmulator sets local httpd to invoke the function on Lambda Runtime Interface Emulator, for example `http://localhost:9000`. only for local.
+// the handler passed to RunWithOptions is not used, the function should set the callback URL of local httpd by WithCallbackURL.
+func WithRuntimeInterfaceEmulator(endpoint string) Option {
+	return func(o *runOptions) {
+		o.rieEndpoint = endpoint
+	}
+}
+
+// WithLambdaOptions sets lambda.Options to runOptions. only for AWS Lambda Runtime and WithInProcessLambda.
 func WithLambdaOptions(options ...lambda.Option) Option {
 	return func(o *runOptions) {
 		o.lambdaOptions = append(o.lambdaOptions, options...)
@@ -218,6 +393,37 @@ func Run(mux http.Handler) error {
 	return RunWithOptions(mux)
 }
 
+// tlsConfig returns tls.Config of local httpd, nil if TLS is not enabled.
+func (o *runOptions) tlsConfig() (*tls.Config, error) {
+	var cert tls.Certificate
+	switch {
+	case o.tlsCertFile != "" || o.tlsKeyFile != "":
+		var err error
+		cert, err = tls.LoadX509KeyPair(o.tlsCertFile, o.tlsKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if cert.Leaf == nil {
+			cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+			if err != nil {
+				return nil, err
+			}
+		}
+	case o.selfSignedTLS:
+		var err error
+		cert, err = generateSelfSignedCertificate()
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
 func RunWithOptions(mux http.Handler, options ...Option) error {
 	runOpts := defaultRunOptions()
 	for _, opt := range options {
@@ -232,24 +438,7 @@ func RunWithOptions(mux http.Handler, options ...Option) error {
 			}
 			runOpts.awsConfig = &cfg
 		}
-		handler := func(ctx context.Context, event json.RawMessage) (*events.APIGatewayProxyResponse, error) {
-			if runOpts.varbose {
-				runOpts.logger.DebugContext(ctx, "lambda invoked", "event", string(event))
-			}
-			ctx = contextWithAWSConfig(ctx, *runOpts.awsConfig)
-			if runOpts.callbackURL != "" {
-				ctx = contextWithCallbackURL(ctx, runOpts.callbackURL)
-			}
-			req, err := NewRequestWithContext(ctx, event)
-			if err != nil {
-				return nil, err
-			}
-			w := &ResponseWriter{
-				header: make(http.Header),
-			}
-			mux.ServeHTTP(w, req)
-			return w.Response(), nil
-		}
+		handler := newLambdaHandler(mux, &runOpts)
 		runOpts.lambdaOptions = append(runOpts.lambdaOptions, lambda.WithContext(runOpts.runCtx))
 		lambda.StartWithOptions(handler, runOpts.lambdaOptions...)
 		return nil
@@ -267,11 +456,69 @@ func RunWithOptions(mux http.Handler, options ...Option) error {
 		runOpts.listener = nil
 	}
 	defer listener.Close()
-	runOpts.callbackURL = fmt.Sprintf("http://%s", listener.Addr().String())
+	tlsConfig, err := runOpts.tlsConfig()
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		if runOpts.callbackURL == "" {
+			runOpts.callbackURL = localCallbackURL("https", listener.Addr())
+		}
+		// @connections API client in the same process trusts the certificate while serving.
+		untrust := trustLocalCertificate(runOpts.callbackURL, tlsConfig.Certificates[0].Leaf)
+		defer untrust()
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	if runOpts.callbackURL == "" {
+		runOpts.callbackURL = fmt.Sprintf("http://%s", listener.Addr().String())
+	}
 	bridge := NewWebsocketHTTPBridgeHandler(mux)
 	bridge.SetLogger(runOpts.logger)
 	bridge.SetVerbose(runOpts.varbose)
 	bridge.SetCallbackURL(runOpts.callbackURL)
+	bridge.SetRouteKeySelector(runOpts.routeKeySelector)
+	bridge.SetAuthorizer(runOpts.authorizer)
+	bridge.SetManagementAPIClient(runOpts.mgmtClient)
+	bridge.SetIdleTimeout(runOpts.idleTimeout)
+	bridge.SetMaxConnectionDuration(runOpts.maxDuration)
+	bridge.SetPingInterval(runOpts.pingInterval)
+	bridge.SetMaxMessageSize(runOpts.maxMessageSize)
+	bridge.SetConnectionsAPIPrincipals(runOpts.principals...)
+	if len(runOpts.allowedOrigins) > 0 {
+		bridge.SetAllowedOrigins(runOpts.allowedOrigins...)
+	}
+	if runOpts.checkOrigin != nil {
+		bridge.SetCheckOrigin(runOpts.checkOrigin)
+	}
+	for stage, stageVariables := range runOpts.stages {
+		bridge.SetStage(stage, stageVariables)
+		slog.InfoContext(runOpts.runCtx, "serving stage", "stage", stage, "callback_url", strings.TrimSuffix(runOpts.callbackURL, "/")+"/"+stage)
+	}
+	if runOpts.recordFile != "" {
+		f, err := os.OpenFile(runOpts.recordFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		bridge.SetRecorder(f)
+		slog.InfoContext(runOpts.runCtx, "recording session", "path", runOpts.recordFile)
+	}
+	switch {
+	case runOpts.rieEndpoint != "":
+		bridge.SetLambdaHandler(NewRuntimeInterfaceEmulatorHandler(runOpts.rieEndpoint))
+		slog.InfoContext(runOpts.runCtx, "invoking lambda runtime interface emulator", "endpoint", runOpts.rieEndpoint)
+	case runOpts.inProcessLambda:
+		// callback URL of the stage and @connections API client are provided by the bridge, same as local httpd.
+		lambdaOpts := runOpts
+		lambdaOpts.awsConfig = nil
+		lambdaOpts.callbackURL = ""
+		lambdaOpts.mgmtClient = nil
+		bridge.SetLambdaHandler(lambda.NewHandlerWithOptions(newLambdaHandler(mux, &lambdaOpts), runOpts.lambdaOptions...))
+	}
+	bridge.SetDefaultRouteResponse(!runOpts.noRouteResponse)
+	for routeKey, enabled := range runOpts.routeResponses {
+		bridge.SetRouteResponse(routeKey, enabled)
+	}
 	srv := http.Server{
 		Addr:    runOpts.address,
 		Handler: bridge,
@@ -286,6 +533,10 @@ func RunWithOptions(mux http.Handler, options ...Option) error {
 		slog.InfoContext(runOpts.runCtx, "shutting down local httpd", "address", runOpts.address)
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
+		// close websocket connections first, $disconnect handler may call @connections API.
+		if err := bridge.Shutdown(shutdownCtx); err != nil {
+			slog.WarnContext(runOpts.runCtx, "failed to drain websocket connections", "detail", err)
+		}
 		srv.Shutdown(shutdownCtx)
 	}()
 	if err := srv.Serve(listener); err != nil {
@@ -0,0 +1,268 @@
+package elevate_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mashiike/elevate"
+)
+
+func TestRunWithOptions__SelfSignedTLS(t *testing.T) {
+	mux := elevate.NewRouteMux()
+	mux.HandleDefault(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		bs, err := io.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if err := elevate.PostToConnection(req.Context(), elevate.ConnectionID(req), bs); err != nil {
+			t.Errorf("PostToConnection() error = %v; want nil", err)
+		}
+	}))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- elevate.RunWithOptions(
+			mux,
+			elevate.WithContext(runCtx),
+			elevate.WithListener(listener),
+			elevate.WithSelfSignedTLS(),
+			elevate.WithRouteResponse(elevate.RouteKeyDefault, false),
+		)
+	}()
+
+	dialer := websocket.Dialer{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	c, _, err := dialer.DialContext(ctx, "wss://"+listener.Addr().String()+"/", nil)
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	defer c.Close()
+	if err := c.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+		t.Fatal("write:", err)
+	}
+	_, message, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal("read:", err)
+	}
+	if string(message) != "hello" {
+		t.Errorf("unexpected message: `%s`", message)
+	}
+	if _, _, err := websocket.DefaultDialer.DialContext(ctx, "ws://"+listener.Addr().String()+"/", nil); err == nil {
+		t.Error("dial ws:// succeeded; want error")
+	}
+	stop()
+	if _, _, err := c.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("read error = %v; want close 1001", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("RunWithOptions() error = %v; want nil", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("RunWithOptions() is not finished")
+	}
+}
+
+func TestRunWithOptions__RouteKeySelector(t *testing.T) {
+	mux := elevate.NewRouteMux()
+	mux.Handle("chat", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("route " + elevate.RouteKey(req)))
+	}))
+	mux.HandleDefault(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("route " + elevate.RouteKey(req)))
+	}))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- elevate.RunWithOptions(
+			mux,
+			elevate.WithContext(runCtx),
+			elevate.WithListener(listener),
+			elevate.WithRouteKeySelector(elevate.MustRouteSelectionExpression("$request.body.message.type")),
+		)
+	}()
+
+	c, _, err := websocket.DefaultDialer.DialContext(ctx, "ws://"+listener.Addr().String()+"/", nil)
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	defer c.Close()
+	for _, tc := range []struct {
+		message string
+		want    string
+	}{
+		{message: `{"message":{"type":"chat"}}`, want: "route chat"},
+		{message: `{"action":"chat"}`, want: "route $default"},
+	} {
+		if err := c.WriteMessage(websocket.TextMessage, []byte(tc.message)); err != nil {
+			t.Fatal("write:", err)
+		}
+		if _, message, err := c.ReadMessage(); err != nil || string(message) != tc.want {
+			t.Errorf("read %s = %s, %v; want %s", tc.message, message, err, tc.want)
+		}
+	}
+	stop()
+	if _, _, err := c.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("read error = %v; want close 1001", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("RunWithOptions() error = %v; want nil", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("RunWithOptions() is not finished")
+	}
+}
+
+// writeCertificate writes self-signed certificate and key for 127.0.0.1 as PEM files.
+func writeCertificate(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"elevate test"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return cert, certFile, keyFile
+}
+
+func TestRunWithOptions__TLS(t *testing.T) {
+	cert, certFile, keyFile := writeCertificate(t, t.TempDir())
+	mux := elevate.NewRouteMux()
+	mux.HandleDefault(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		bs, err := io.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		// @connections API client in the same process trusts the certificate of WithTLS.
+		if err := elevate.PostToConnection(req.Context(), elevate.ConnectionID(req), bs); err != nil {
+			t.Errorf("PostToConnection() error = %v; want nil", err)
+		}
+	}))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- elevate.RunWithOptions(
+			mux,
+			elevate.WithContext(runCtx),
+			elevate.WithListener(listener),
+			elevate.WithTLS(certFile, keyFile),
+			elevate.WithRouteResponse(elevate.RouteKeyDefault, false),
+		)
+	}()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	dialer := websocket.Dialer{
+		TLSClientConfig: &tls.Config{RootCAs: pool},
+	}
+	c, _, err := dialer.DialContext(ctx, "wss://"+listener.Addr().String()+"/", nil)
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	defer c.Close()
+	if err := c.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+		t.Fatal("write:", err)
+	}
+	if _, message, err := c.ReadMessage(); err != nil || string(message) != "hello" {
+		t.Errorf("read = %s, %v; want hello", message, err)
+	}
+	stop()
+	if _, _, err := c.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("read error = %v; want close 1001", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("RunWithOptions() error = %v; want nil", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("RunWithOptions() is not finished")
+	}
+}
+
+func TestRunWithOptions__TLSInvalidFile(t *testing.T) {
+	dir := t.TempDir()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = elevate.RunWithOptions(
+		elevate.NewRouteMux(),
+		elevate.WithContext(ctx),
+		elevate.WithListener(listener),
+		elevate.WithTLS(filepath.Join(dir, "not_found.pem"), filepath.Join(dir, "not_found.key")),
+	)
+	if err == nil {
+		t.Error("RunWithOptions() with missing certificate file succeeded; want error")
+	}
+}
@@ -0,0 +1,168 @@
+package elevatetest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var clientSeq atomic.Int64
+
+// Client is a websocket client connected to Server.
+type Client struct {
+	t            testing.TB
+	conn         *websocket.Conn
+	connectionID string
+	timeout      time.Duration
+	closeCode    chan int
+}
+
+// Dial connects to the Server with query and headers, it fails the test if the upgrade is failed.
+// the connection is closed on cleanup of the test.
+func (s *Server) Dial(t testing.TB, query url.Values, header http.Header) *Client {
+	t.Helper()
+	client, resp, err := s.TryDial(t, query, header)
+	if err != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		t.Fatalf("elevatetest: dial failed: status=%d: %v", status, err)
+	}
+	return client
+}
+
+// TryDial connects to the Server with query and headers, and returns the response of upgrade.
+// it is useful to test rejected upgrade, for example by authorizer or $connect handler.
+func (s *Server) TryDial(t testing.TB, query url.Values, header http.Header) (*Client, *http.Response, error) {
+	t.Helper()
+	u := s.URL
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	clientID := strconv.FormatInt(clientSeq.Add(1), 10)
+	h := header.Clone()
+	if h == nil {
+		h = make(http.Header)
+	}
+	h.Set(HTTPHeaderClientID, clientID)
+	ctx, cancel := contextWithTimeout(s.timeout)
+	defer cancel()
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, u, h)
+	if err != nil {
+		return nil, resp, err
+	}
+	c := &Client{
+		t:            t,
+		conn:         conn,
+		connectionID: s.connectionIDOf(clientID),
+		timeout:      s.timeout,
+		closeCode:    make(chan int, 1),
+	}
+	conn.SetCloseHandler(func(code int, text string) error {
+		select {
+		case c.closeCode <- code:
+		default:
+		}
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(time.Second))
+		return nil
+	})
+	s.mu.Lock()
+	s.dialed = append(s.dialed, c)
+	s.mu.Unlock()
+	t.Cleanup(c.Close)
+	return c, resp, nil
+}
+
+// ConnectionID returns the connection id of the Client.
+func (c *Client) ConnectionID() string {
+	return c.connectionID
+}
+
+// Conn returns underlying *websocket.Conn.
+func (c *Client) Conn() *websocket.Conn {
+	return c.conn
+}
+
+// Send sends text message.
+func (c *Client) Send(data string) {
+	c.t.Helper()
+	if err := c.conn.WriteMessage(websocket.TextMessage, []byte(data)); err != nil {
+		c.t.Fatalf("elevatetest: send failed: %v", err)
+	}
+}
+
+// SendBinary sends binary message.
+func (c *Client) SendBinary(data []byte) {
+	c.t.Helper()
+	if err := c.conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
+		c.t.Fatalf("elevatetest: send failed: %v", err)
+	}
+}
+
+// Read reads next message, it fails the test if no message is received within timeout.
+func (c *Client) Read() []byte {
+	c.t.Helper()
+	if err := c.conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		c.t.Fatalf("elevatetest: set read deadline failed: %v", err)
+	}
+	_, data, err := c.conn.ReadMessage()
+	if err != nil {
+		c.t.Fatalf("elevatetest: read failed: %v", err)
+	}
+	return data
+}
+
+// Expect reads next message and reports error if it is not want.
+func (c *Client) Expect(want string) {
+	c.t.Helper()
+	if got := string(c.Read()); got != want {
+		c.t.Errorf("elevatetest: message = `%s`; want `%s`", got, want)
+	}
+}
+
+// ExpectClose reads until close frame is received and reports error if close code is not want.
+func (c *Client) ExpectClose(code int) {
+	c.t.Helper()
+	if err := c.conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		c.t.Fatalf("elevatetest: set read deadline failed: %v", err)
+	}
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err == nil {
+			c.t.Logf("elevatetest: skip message before close: `%s`", data)
+			continue
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) {
+			select {
+			case got := <-c.closeCode:
+				closeErr = &websocket.CloseError{Code: got}
+			default:
+				c.t.Fatalf("elevatetest: close frame is not received: %v", err)
+				return
+			}
+		}
+		if closeErr.Code != code {
+			c.t.Errorf("elevatetest: close code = %d; want %d", closeErr.Code, code)
+		}
+		return
+	}
+}
+
+// Close sends close frame 1000 Normal Closure and closes the connection.
+func (c *Client) Close() {
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	c.conn.Close()
+}
+
+func contextWithTimeout(timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), timeout)
+}
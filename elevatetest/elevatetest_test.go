@@ -0,0 +1,98 @@
+package elevatetest_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/mashiike/elevate"
+	"github.com/mashiike/elevate/elevatetest"
+)
+
+func newChatHandler() http.Handler {
+	mux := elevate.NewRouteMux()
+	mux.HandleConnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if elevate.QueryStringParameters(req)["name"] == "" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	mux.HandleDefault(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		bs, err := io.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if string(bs) == "bye" {
+			elevate.DeleteConnection(req.Context(), elevate.ConnectionID(req))
+			return
+		}
+		w.Write([]byte(strings.ToUpper(string(bs))))
+	}))
+	return mux
+}
+
+func TestServer(t *testing.T) {
+	srv := elevatetest.NewServer(newChatHandler(), elevatetest.WithStage("develop", nil))
+	defer srv.Close()
+	if !strings.HasSuffix(srv.URL, "/develop") {
+		t.Errorf("URL = %s; want suffix /develop", srv.URL)
+	}
+
+	if _, resp, err := srv.TryDial(t, nil, nil); err == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("TryDial() without name: err = %v; want 400", err)
+	}
+	alice := srv.Dial(t, url.Values{"name": {"alice"}}, nil)
+	bob := srv.Dial(t, url.Values{"name": {"bob"}}, nil)
+	if alice.ConnectionID() == "" || alice.ConnectionID() == bob.ConnectionID() {
+		t.Fatalf("unexpected connection ids: %s, %s", alice.ConnectionID(), bob.ConnectionID())
+	}
+	if got := srv.Connections(); len(got) != 2 {
+		t.Errorf("Connections() = %v; want 2 connections", got)
+	}
+
+	alice.Send("hello")
+	alice.Expect("HELLO")
+
+	ctx := elevate.ContextWithCallbackURL(context.Background(), srv.CallbackURL)
+	if err := elevate.PostToConnection(ctx, bob.ConnectionID(), []byte("from worker")); err != nil {
+		t.Fatal(err)
+	}
+	bob.Expect("from worker")
+	srv.AssertPosted(t, bob.ConnectionID(), "from worker")
+	srv.AssertNotPosted(t, alice.ConnectionID())
+
+	bob.Send("bye")
+	bob.ExpectClose(websocket.CloseNormalClosure)
+	if err := elevate.PostToConnection(ctx, bob.ConnectionID(), []byte("after bye")); !elevate.ConnectionIsGone(err) {
+		t.Errorf("PostToConnection() error = %v; want GoneException", err)
+	}
+	if got := srv.PostsTo(bob.ConnectionID()); len(got) != 1 {
+		t.Errorf("PostsTo() = %q; want only delivered post", got)
+	}
+}
+
+func TestServer__ClientIDHeader(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	mux := elevate.NewRouteMux()
+	mux.HandleConnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		headers <- req.Header.Clone()
+	}))
+	srv := elevatetest.NewServer(mux)
+	defer srv.Close()
+
+	client := srv.Dial(t, nil, http.Header{"X-Test": {"value"}})
+	header := <-headers
+	if got := header.Get(elevatetest.HTTPHeaderClientID); got != "" {
+		t.Errorf("%s = %s; want removed before the handler", elevatetest.HTTPHeaderClientID, got)
+	}
+	if got := header.Get("X-Test"); got != "value" {
+		t.Errorf("X-Test = %s; want value", got)
+	}
+	if client.ConnectionID() == "" {
+		t.Error("ConnectionID() is empty; want tracked without the header")
+	}
+}
@@ -0,0 +1,237 @@
+package elevatetest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/mashiike/elevate"
+)
+
+// default values of requestContext, same as testdata of API Gateway.
+var (
+	DefaultEventAPIID    = "abcdefghij"
+	DefaultEventStage    = "develop"
+	DefaultEventRegion   = "us-east-1"
+	DefaultEventSourceIP = "192.0.2.1"
+)
+
+const requestTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// Event is a builder of synthetic API Gateway WebSocket event, for unit tests of handlers without the bridge.
+// it is created by ConnectEvent, MessageEvent or DisconnectEvent, and converted by Request or JSON.
+type Event struct {
+	proxyReq   events.APIGatewayWebsocketProxyRequest
+	disconnect elevate.DisconnectStatus
+}
+
+// ConnectEvent returns $connect event, with headers of websocket upgrade request like API Gateway.
+func ConnectEvent() *Event {
+	e := newEvent("CONNECT", elevate.RouteKeyConnect)
+	e.WithHeader("Host", e.proxyReq.RequestContext.DomainName)
+	e.WithHeader("Sec-WebSocket-Key", base64.StdEncoding.EncodeToString(randomBytes(16)))
+	e.WithHeader("Sec-WebSocket-Version", "13")
+	e.WithHeader("X-Forwarded-For", DefaultEventSourceIP)
+	e.WithHeader("X-Forwarded-Port", "443")
+	e.WithHeader("X-Forwarded-Proto", "https")
+	return e
+}
+
+// MessageEvent returns MESSAGE event of the route key with text body.
+func MessageEvent(routeKey string, body string) *Event {
+	e := newEvent("MESSAGE", routeKey)
+	e.proxyReq.RequestContext.MessageID = generateID(10)
+	e.proxyReq.Body = body
+	return e
+}
+
+// DisconnectEvent returns $disconnect event with requestContext.disconnectStatusCode and requestContext.disconnectReason.
+func DisconnectEvent(code int, reason string) *Event {
+	e := newEvent("DISCONNECT", elevate.RouteKeyDisconnect)
+	e.WithHeader("Host", e.proxyReq.RequestContext.DomainName)
+	// same as API Gateway, these headers are sent with empty value.
+	for _, key := range []string{"x-api-key", "X-Forwarded-For", "x-restapi"} {
+		e.setHeader(key, []string{""})
+	}
+	e.disconnect.StatusCode = code
+	e.disconnect.Reason = reason
+	return e
+}
+
+func newEvent(eventType string, routeKey string) *Event {
+	now := time.Now()
+	requestID := generateID(11)
+	e := &Event{
+		proxyReq: events.APIGatewayWebsocketProxyRequest{
+			RequestContext: events.APIGatewayWebsocketProxyRequestContext{
+				RouteKey:          routeKey,
+				EventType:         eventType,
+				ExtendedRequestID: requestID,
+				RequestID:         requestID,
+				RequestTime:       now.Format(requestTimeFormat),
+				RequestTimeEpoch:  now.UnixMilli(),
+				MessageDirection:  "IN",
+				Stage:             DefaultEventStage,
+				ConnectedAt:       now.UnixMilli(),
+				Identity: events.APIGatewayRequestIdentity{
+					SourceIP: DefaultEventSourceIP,
+				},
+				ConnectionID: generateID(11),
+				APIID:        DefaultEventAPIID,
+				DomainName:   DefaultEventAPIID + ".execute-api." + DefaultEventRegion + ".amazonaws.com",
+			},
+		},
+	}
+	return e
+}
+
+// WithConnectionID sets requestContext.connectionId, use same id for events of a connection.
+func (e *Event) WithConnectionID(connectionID string) *Event {
+	e.proxyReq.RequestContext.ConnectionID = connectionID
+	return e
+}
+
+// WithConnectedAt sets requestContext.connectedAt.
+func (e *Event) WithConnectedAt(connectedAt time.Time) *Event {
+	e.proxyReq.RequestContext.ConnectedAt = connectedAt.UnixMilli()
+	return e
+}
+
+// WithDomainName sets requestContext.domainName, and Host header of $connect and $disconnect.
+func (e *Event) WithDomainName(domainName string) *Event {
+	e.proxyReq.RequestContext.DomainName = domainName
+	if _, ok := e.proxyReq.Headers["Host"]; ok {
+		e.setHeader("Host", []string{domainName})
+	}
+	return e
+}
+
+// WithStage sets requestContext.stage and stageVariables.
+func (e *Event) WithStage(stage string, stageVariables map[string]string) *Event {
+	e.proxyReq.RequestContext.Stage = stage
+	e.proxyReq.StageVariables = stageVariables
+	return e
+}
+
+// WithSourceIP sets requestContext.identity.sourceIp.
+func (e *Event) WithSourceIP(sourceIP string) *Event {
+	e.proxyReq.RequestContext.Identity.SourceIP = sourceIP
+	if _, ok := e.proxyReq.Headers["X-Forwarded-For"]; ok && e.proxyReq.RequestContext.EventType == "CONNECT" {
+		e.setHeader("X-Forwarded-For", []string{sourceIP})
+	}
+	return e
+}
+
+// WithHeader adds values of the header to headers and multiValueHeaders.
+// API Gateway sends headers of the upgrade request only on $connect.
+func (e *Event) WithHeader(key string, values ...string) *Event {
+	key = http.CanonicalHeaderKey(key)
+	return e.setHeader(key, append(e.proxyReq.MultiValueHeaders[key], values...))
+}
+
+func (e *Event) setHeader(key string, values []string) *Event {
+	if len(values) == 0 {
+		return e
+	}
+	if e.proxyReq.Headers == nil {
+		e.proxyReq.Headers = make(map[string]string)
+		e.proxyReq.MultiValueHeaders = make(map[string][]string)
+	}
+	e.proxyReq.Headers[key] = values[len(values)-1]
+	e.proxyReq.MultiValueHeaders[key] = values
+	return e
+}
+
+// WithQuery adds values of the parameter to queryStringParameters and multiValueQueryStringParameters.
+// API Gateway sends query string parameters only on $connect.
+func (e *Event) WithQuery(key string, values ...string) *Event {
+	if len(values) == 0 {
+		return e
+	}
+	if e.proxyReq.QueryStringParameters == nil {
+		e.proxyReq.QueryStringParameters = make(map[string]string)
+		e.proxyReq.MultiValueQueryStringParameters = make(map[string][]string)
+	}
+	values = append(e.proxyReq.MultiValueQueryStringParameters[key], values...)
+	e.proxyReq.QueryStringParameters[key] = values[len(values)-1]
+	e.proxyReq.MultiValueQueryStringParameters[key] = values
+	return e
+}
+
+// WithAuthorizer sets requestContext.authorizer, same as the response of Lambda REQUEST authorizer.
+// values of authorizerContext are flattened with principalId and integrationLatency.
+func (e *Event) WithAuthorizer(principalID string, authorizerContext map[string]interface{}) *Event {
+	authCtx := make(map[string]interface{}, len(authorizerContext)+2)
+	for k, v := range authorizerContext {
+		authCtx[k] = v
+	}
+	authCtx["principalId"] = principalID
+	authCtx["integrationLatency"] = 0
+	e.proxyReq.RequestContext.Authorizer = authCtx
+	return e
+}
+
+// WithBody sets text body.
+func (e *Event) WithBody(body string) *Event {
+	e.proxyReq.Body = body
+	e.proxyReq.IsBase64Encoded = false
+	return e
+}
+
+// WithBinaryBody sets base64 encoded body with isBase64Encoded, same as binary frame.
+func (e *Event) WithBinaryBody(data []byte) *Event {
+	e.proxyReq.Body = base64.StdEncoding.EncodeToString(data)
+	e.proxyReq.IsBase64Encoded = true
+	return e
+}
+
+// ProxyRequest returns a copy of the event as events.APIGatewayWebsocketProxyRequest.
+// disconnect status is not included, use JSON for $disconnect.
+func (e *Event) ProxyRequest() events.APIGatewayWebsocketProxyRequest {
+	return e.proxyReq
+}
+
+// MarshalJSON implements json.Marshaler, it returns the payload of Lambda invocation.
+func (e *Event) MarshalJSON() ([]byte, error) {
+	return elevate.MarshalProxyRequest(&e.proxyReq, e.disconnect)
+}
+
+// JSON returns the payload of Lambda invocation, it panics if marshaling is failed.
+func (e *Event) JSON() json.RawMessage {
+	bs, err := e.MarshalJSON()
+	if err != nil {
+		panic("elevatetest: marshal event: " + err.Error())
+	}
+	return bs
+}
+
+// Request returns *http.Request converted by elevate.NewRequest, same as the handler receives.
+// it panics if conversion is failed, like httptest.NewRequest.
+func (e *Event) Request() *http.Request {
+	return e.RequestWithContext(context.Background())
+}
+
+// RequestWithContext is same as Request with context.
+func (e *Event) RequestWithContext(ctx context.Context) *http.Request {
+	req, err := elevate.NewRequestWithContext(ctx, e.JSON())
+	if err != nil {
+		panic("elevatetest: new request: " + err.Error())
+	}
+	return req
+}
+
+func generateID(size int) string {
+	return base64.URLEncoding.EncodeToString(randomBytes(size))
+}
+
+func randomBytes(size int) []byte {
+	bs := make([]byte, size)
+	if _, err := rand.Read(bs); err != nil {
+		panic("elevatetest: " + err.Error())
+	}
+	return bs
+}
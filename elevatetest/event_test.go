@@ -0,0 +1,168 @@
+package elevatetest_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mashiike/elevate"
+	"github.com/mashiike/elevate/elevatetest"
+)
+
+func TestConnectEvent(t *testing.T) {
+	req := elevatetest.ConnectEvent().
+		WithConnectionID("ZZZZZZZZZZZZZZZ=").
+		WithQuery("room", "a", "b").
+		WithHeader("Authorization", "Bearer token").
+		WithAuthorizer("alice", map[string]interface{}{"role": "admin"}).
+		WithSourceIP("192.168.1.1").
+		Request()
+	if got := elevate.RouteKey(req); got != elevate.RouteKeyConnect {
+		t.Errorf("RouteKey() = %s; want %s", got, elevate.RouteKeyConnect)
+	}
+	if got := elevate.EventType(req); got != "CONNECT" {
+		t.Errorf("EventType() = %s; want CONNECT", got)
+	}
+	if got := elevate.ConnectionID(req); got != "ZZZZZZZZZZZZZZZ=" {
+		t.Errorf("ConnectionID() = %s; want ZZZZZZZZZZZZZZZ=", got)
+	}
+	if got := elevate.QueryStringParameters(req)["room"]; got != "b" {
+		t.Errorf("QueryStringParameters()[room] = %s; want b", got)
+	}
+	if got := elevate.MultiValueQueryStringParameters(req)["room"]; len(got) != 2 {
+		t.Errorf("MultiValueQueryStringParameters()[room] = %v; want [a b]", got)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("Authorization = %s; want Bearer token", got)
+	}
+	if got := req.Header.Get("X-Forwarded-For"); got != "192.168.1.1" {
+		t.Errorf("X-Forwarded-For = %s; want 192.168.1.1", got)
+	}
+	if got := elevate.PrincipalID(req); got != "alice" {
+		t.Errorf("PrincipalID() = %s; want alice", got)
+	}
+	if got := elevate.AuthorizerContext(req)["role"]; got != "admin" {
+		t.Errorf("AuthorizerContext()[role] = %v; want admin", got)
+	}
+	if got := req.Host; got != elevatetest.DefaultEventAPIID+".execute-api."+elevatetest.DefaultEventRegion+".amazonaws.com" {
+		t.Errorf("Host = %s; want domain name of the API", got)
+	}
+	if got := elevate.SourceIP(req); got != "192.168.1.1" {
+		t.Errorf("SourceIP() = %s; want 192.168.1.1", got)
+	}
+	if got := elevate.Stage(req); got != elevatetest.DefaultEventStage {
+		t.Errorf("Stage() = %s; want %s", got, elevatetest.DefaultEventStage)
+	}
+	if elevate.ConnectedAt(req).IsZero() {
+		t.Error("ConnectedAt() is zero")
+	}
+}
+
+func TestMessageEvent(t *testing.T) {
+	mux := elevate.NewRouteMux()
+	mux.Handle("echo", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		bs, err := io.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(bs)
+	}))
+
+	cases := []struct {
+		name  string
+		event *elevatetest.Event
+		want  string
+	}{
+		{
+			name:  "text",
+			event: elevatetest.MessageEvent("echo", `{"action":"echo"}`),
+			want:  `{"action":"echo"}`,
+		},
+		{
+			name:  "binary",
+			event: elevatetest.MessageEvent("echo", "").WithBinaryBody([]byte{0x00, 0xff}),
+			want:  "\x00\xff",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, c.event.WithStage("production", map[string]string{"table": "prod"}).Request())
+			if got := w.Body.String(); got != c.want {
+				t.Errorf("body = %q; want %q", got, c.want)
+			}
+			req := c.event.Request()
+			if got := elevate.StageVariables(req)["table"]; got != "prod" {
+				t.Errorf("StageVariables()[table] = %s; want prod", got)
+			}
+		})
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(cases[1].event.WithDomainName("example.com").JSON(), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload["isBase64Encoded"] != true || payload["body"] != "AP8=" {
+		t.Errorf("body = %v, isBase64Encoded = %v; want AP8=, true", payload["body"], payload["isBase64Encoded"])
+	}
+	if payload["headers"] != nil {
+		t.Errorf("headers = %v; want none, MESSAGE event has no headers", payload["headers"])
+	}
+}
+
+func TestDisconnectEvent(t *testing.T) {
+	event := elevatetest.DisconnectEvent(1001, "Going away")
+	var payload struct {
+		RequestContext map[string]interface{} `json:"requestContext"`
+	}
+	if err := json.Unmarshal(event.JSON(), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if got := payload.RequestContext["disconnectStatusCode"]; got != float64(1001) {
+		t.Errorf("requestContext.disconnectStatusCode = %v; want 1001", got)
+	}
+	req := event.Request()
+	if got := elevate.RouteKey(req); got != elevate.RouteKeyDisconnect {
+		t.Errorf("RouteKey() = %s; want %s", got, elevate.RouteKeyDisconnect)
+	}
+	code, reason := elevate.DisconnectReason(req)
+	if code != 1001 || reason != "Going away" {
+		t.Errorf("DisconnectReason() = %d, %s; want 1001, Going away", code, reason)
+	}
+}
+
+func TestDisconnectEvent__SameAsBridge(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	mux := elevate.NewRouteMux()
+	mux.HandleDisconnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		headers <- req.Header.Clone()
+	}))
+	srv := elevatetest.NewServer(mux)
+	defer srv.Close()
+	client := srv.Dial(t, nil, http.Header{"X-Test": {"value"}})
+	client.Close()
+	got := <-headers
+
+	want := elevatetest.DisconnectEvent(1000, "").Request().Header
+	if len(got) != len(want) {
+		t.Errorf("headers of bridge = %v; want %v", got, want)
+	}
+	for k, v := range want {
+		g, ok := got[k]
+		if !ok {
+			t.Errorf("header %s of bridge is missing", k)
+			continue
+		}
+		if k == "Host" || strings.HasPrefix(k, "Elevate-") {
+			// values depend on the connection.
+			continue
+		}
+		if !reflect.DeepEqual(g, v) {
+			t.Errorf("header %s of bridge = %v; want %v", k, g, v)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package elevatetest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi/types"
+	"github.com/aws/smithy-go"
+	"github.com/mashiike/elevate"
+)
+
+// operation names of @connections API, used by Call and ManagementAPI.FailNext.
+const (
+	OperationPostToConnection = "PostToConnection"
+	OperationDeleteConnection = "DeleteConnection"
+	OperationGetConnection    = "GetConnection"
+)
+
+// Call is a call of @connections API recorded by ManagementAPI.
+type Call struct {
+	Operation    string
+	ConnectionID string
+	// Data is the payload of PostToConnection.
+	Data []byte
+	// Err is the error returned to the caller.
+	Err error
+}
+
+// ManagementAPI is an in-memory fake of @connections API, it implements elevate.ManagementAPIClient.
+// all connections exist unless they are deleted or marked as gone by SetGone.
+type ManagementAPI struct {
+	mu          sync.Mutex
+	calls       []Call
+	connections map[string]time.Time
+	gone        map[string]bool
+	failures    []failure
+}
+
+type failure struct {
+	operation    string
+	connectionID string
+	err          error
+}
+
+var _ elevate.ManagementAPIClient = (*ManagementAPI)(nil)
+
+// NewManagementAPI returns a new ManagementAPI.
+func NewManagementAPI() *ManagementAPI {
+	return &ManagementAPI{
+		connections: make(map[string]time.Time),
+		gone:        make(map[string]bool),
+	}
+}
+
+// Context returns context with the ManagementAPI, PostToConnection, DeleteConnection, GetConnection and Broadcast use it.
+func (m *ManagementAPI) Context(parent context.Context) context.Context {
+	return elevate.ContextWithManagementAPIClient(parent, m)
+}
+
+// SetGone marks connections as gone, calls for them return GoneException.
+func (m *ManagementAPI) SetGone(connectionIDs ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range connectionIDs {
+		m.gone[id] = true
+	}
+}
+
+// FailNext scripts errors returned by next calls of the operation for the connection, one error per call in order.
+// empty operation or connectionID matches any.
+func (m *ManagementAPI) FailNext(operation string, connectionID string, errs ...error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, err := range errs {
+		m.failures = append(m.failures, failure{operation: operation, connectionID: connectionID, err: err})
+	}
+}
+
+// PostToConnection implements elevate.ManagementAPIClient.
+func (m *ManagementAPI) PostToConnection(ctx context.Context, params *apigatewaymanagementapi.PostToConnectionInput, optFns ...func(*apigatewaymanagementapi.Options)) (*apigatewaymanagementapi.PostToConnectionOutput, error) {
+	data := append([]byte(nil), params.Data...)
+	if _, err := m.call(OperationPostToConnection, aws.ToString(params.ConnectionId), data); err != nil {
+		return nil, err
+	}
+	return &apigatewaymanagementapi.PostToConnectionOutput{}, nil
+}
+
+// DeleteConnection implements elevate.ManagementAPIClient, the connection is gone after deleted.
+func (m *ManagementAPI) DeleteConnection(ctx context.Context, params *apigatewaymanagementapi.DeleteConnectionInput, optFns ...func(*apigatewaymanagementapi.Options)) (*apigatewaymanagementapi.DeleteConnectionOutput, error) {
+	connectionID := aws.ToString(params.ConnectionId)
+	if _, err := m.call(OperationDeleteConnection, connectionID, nil); err != nil {
+		return nil, err
+	}
+	m.SetGone(connectionID)
+	return &apigatewaymanagementapi.DeleteConnectionOutput{}, nil
+}
+
+// GetConnection implements elevate.ManagementAPIClient, connectedAt is the time of the first call for the connection.
+func (m *ManagementAPI) GetConnection(ctx context.Context, params *apigatewaymanagementapi.GetConnectionInput, optFns ...func(*apigatewaymanagementapi.Options)) (*apigatewaymanagementapi.GetConnectionOutput, error) {
+	connectedAt, err := m.call(OperationGetConnection, aws.ToString(params.ConnectionId), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &apigatewaymanagementapi.GetConnectionOutput{
+		ConnectedAt:  aws.Time(connectedAt),
+		LastActiveAt: aws.Time(connectedAt),
+		Identity: &types.Identity{
+			SourceIp: aws.String(DefaultEventSourceIP),
+		},
+	}, nil
+}
+
+// call records the call and returns connectedAt of the connection or the error.
+func (m *ManagementAPI) call(operation string, connectionID string, data []byte) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	connectedAt, ok := m.connections[connectionID]
+	if !ok {
+		connectedAt = time.Now()
+		m.connections[connectionID] = connectedAt
+	}
+	var err error
+	for i, f := range m.failures {
+		if (f.operation == "" || f.operation == operation) && (f.connectionID == "" || f.connectionID == connectionID) {
+			err = f.err
+			m.failures = append(m.failures[:i], m.failures[i+1:]...)
+			break
+		}
+	}
+	if err == nil && m.gone[connectionID] {
+		err = GoneError()
+	}
+	if err != nil {
+		err = &smithy.OperationError{
+			ServiceID:     apigatewaymanagementapi.ServiceID,
+			OperationName: operation,
+			Err:           err,
+		}
+	}
+	m.calls = append(m.calls, Call{
+		Operation:    operation,
+		ConnectionID: connectionID,
+		Data:         data,
+		Err:          err,
+	})
+	return connectedAt, err
+}
+
+// GoneError returns GoneException, same as @connections API returns for closed connection.
+func GoneError() error {
+	return &types.GoneException{Message: aws.String("Gone")}
+}
+
+// LimitExceededError returns LimitExceededException, same as @connections API returns when the rate limit is exceeded.
+func LimitExceededError() error {
+	return &types.LimitExceededException{Message: aws.String("Limit Exceeded")}
+}
+
+// ThrottlingError returns ThrottlingException error.
+func ThrottlingError() error {
+	return &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded", Fault: smithy.FaultClient}
+}
+
+// Calls returns recorded calls in called order.
+func (m *ManagementAPI) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// PostsTo returns data successfully posted to the connection, in called order.
+func (m *ManagementAPI) PostsTo(connectionID string) [][]byte {
+	var data [][]byte
+	for _, call := range m.Calls() {
+		if call.Operation == OperationPostToConnection && call.ConnectionID == connectionID && call.Err == nil {
+			data = append(data, call.Data)
+		}
+	}
+	return data
+}
+
+// AssertPosted reports error if data is not posted to the connection.
+func (m *ManagementAPI) AssertPosted(t testing.TB, connectionID string, data string) {
+	t.Helper()
+	for _, posted := range m.PostsTo(connectionID) {
+		if string(posted) == data {
+			return
+		}
+	}
+	t.Errorf("elevatetest: `%s` is not posted to %s", data, connectionID)
+}
+
+// AssertNotPosted reports error if any data is posted to the connection.
+func (m *ManagementAPI) AssertNotPosted(t testing.TB, connectionID string) {
+	t.Helper()
+	if posts := m.PostsTo(connectionID); len(posts) > 0 {
+		t.Errorf("elevatetest: %d messages are posted to %s; want none", len(posts), connectionID)
+	}
+}
+
+// AssertDeleted reports error if the connection is not deleted by DeleteConnection.
+func (m *ManagementAPI) AssertDeleted(t testing.TB, connectionID string) {
+	t.Helper()
+	for _, call := range m.Calls() {
+		if call.Operation == OperationDeleteConnection && call.ConnectionID == connectionID && call.Err == nil {
+			return
+		}
+	}
+	t.Errorf("elevatetest: %s is not deleted", connectionID)
+}
+
+// AssertCalls reports error if the number of calls of the operation is not n.
+func (m *ManagementAPI) AssertCalls(t testing.TB, operation string, n int) {
+	t.Helper()
+	var got int
+	for _, call := range m.Calls() {
+		if call.Operation == operation {
+			got++
+		}
+	}
+	if got != n {
+		t.Errorf("elevatetest: %s is called %d times; want %d", operation, got, n)
+	}
+}
@@ -0,0 +1,71 @@
+package elevatetest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi/types"
+	"github.com/mashiike/elevate"
+	"github.com/mashiike/elevate/elevatetest"
+)
+
+func TestManagementAPI(t *testing.T) {
+	store := elevate.NewInMemoryConnectionStore()
+	var result *elevate.BroadcastResult
+	mux := elevate.NewRouteMux()
+	mux.HandleConnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	mux.HandleDefault(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conns, err := store.List(req.Context())
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		ids := make([]string, 0, len(conns))
+		for _, conn := range conns {
+			ids = append(ids, conn.ConnectionID)
+		}
+		result, err = elevate.Broadcast(req.Context(), ids, []byte("hello"))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	handler := elevate.NewConnectionStoreHandler(store, mux)
+
+	api := elevatetest.NewManagementAPI()
+	ctx := api.Context(context.Background())
+	for _, id := range []string{"alice", "bob", "carol"} {
+		handler.ServeHTTP(httptest.NewRecorder(), elevatetest.ConnectEvent().WithConnectionID(id).RequestWithContext(ctx))
+	}
+	api.SetGone("bob")
+	api.FailNext(elevatetest.OperationPostToConnection, "carol", elevatetest.LimitExceededError())
+	handler.ServeHTTP(httptest.NewRecorder(), elevatetest.MessageEvent("$default", "hi").WithConnectionID("alice").RequestWithContext(ctx))
+
+	api.AssertPosted(t, "alice", "hello")
+	api.AssertNotPosted(t, "bob")
+	api.AssertNotPosted(t, "carol")
+	api.AssertCalls(t, elevatetest.OperationPostToConnection, 3)
+	if len(result.Gone) != 1 || result.Gone[0] != "bob" {
+		t.Errorf("Gone = %v; want [bob]", result.Gone)
+	}
+	var limitErr *types.LimitExceededException
+	if !errors.As(result.Failed["carol"], &limitErr) {
+		t.Errorf("Failed[carol] = %v; want LimitExceededException", result.Failed["carol"])
+	}
+	if conn, _ := store.Get(ctx, "bob"); conn != nil {
+		t.Error("gone connection bob is not pruned")
+	}
+
+	if err := elevate.DeleteConnection(ctx, "alice"); err != nil {
+		t.Fatalf("DeleteConnection() error = %v; want nil", err)
+	}
+	api.AssertDeleted(t, "alice")
+	if ok, err := elevate.ExitsConnection(ctx, "alice"); ok || err != nil {
+		t.Errorf("ExitsConnection(alice) = %v, %v; want false, nil", ok, err)
+	}
+	if ok, err := elevate.ExitsConnection(ctx, "carol"); !ok || err != nil {
+		t.Errorf("ExitsConnection(carol) = %v, %v; want true, nil", ok, err)
+	}
+}
@@ -0,0 +1,30 @@
+package elevatetest
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/mashiike/elevate"
+)
+
+// AssertReplay replays the recording file written by elevate.WithRecordFile or SetRecorder, and reports differences of responses as errors.
+// @connections API calls of the handler are captured by returned ManagementAPI.
+func AssertReplay(t testing.TB, handler http.Handler, path string) *ManagementAPI {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("elevatetest: open recording: %v", err)
+	}
+	defer f.Close()
+	api := NewManagementAPI()
+	diffs, err := elevate.Replay(api.Context(context.Background()), handler, f)
+	if err != nil {
+		t.Fatalf("elevatetest: replay %s: %v", path, err)
+	}
+	for _, diff := range diffs {
+		t.Errorf("elevatetest: replay %s: %s", path, diff)
+	}
+	return api
+}
@@ -0,0 +1,33 @@
+package elevatetest_test
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mashiike/elevate"
+	"github.com/mashiike/elevate/elevatetest"
+)
+
+func TestAssertReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	srv := elevatetest.NewServer(newChatHandler(), elevatetest.WithBridge(func(bridge *elevate.WebsocketHTTPBridgeHandler) {
+		bridge.SetRecorder(f)
+	}))
+	client := srv.Dial(t, url.Values{"name": {"alice"}}, nil)
+	client.Send("hello")
+	client.Expect("HELLO")
+	client.Send("bye")
+	client.ExpectClose(1000)
+	connectionID := client.ConnectionID()
+	srv.Close()
+
+	api := elevatetest.AssertReplay(t, newChatHandler(), path)
+	api.AssertDeleted(t, connectionID)
+}
@@ -0,0 +1,308 @@
+// Package elevatetest provides utilities for end-to-end testing of elevate handlers, like net/http/httptest.
+package elevatetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/mashiike/elevate"
+)
+
+// DefaultTimeout is a default timeout of Client.Expect and Client.ExpectClose.
+var DefaultTimeout = 5 * time.Second
+
+// HTTPHeaderClientID is a header to identify Client in $connect, it is set by Server.Dial.
+// the header is removed by Server before the bridge, the handler does not see it same as API Gateway.
+var HTTPHeaderClientID = "Elevatetest-Client-Id"
+
+// clientIDContextKey is a context key of the value of HTTPHeaderClientID.
+type clientIDContextKey struct{}
+
+func clientIDFromContext(ctx context.Context) string {
+	clientID, _ := ctx.Value(clientIDContextKey{}).(string)
+	return clientID
+}
+
+// Post is a request of @connections API POST received by Server.
+type Post struct {
+	ConnectionID string
+	Data         []byte
+}
+
+type serverOptions struct {
+	stage          string
+	stageVariables map[string]string
+	timeout        time.Duration
+	configure      []func(*elevate.WebsocketHTTPBridgeHandler)
+	lambdaHandler  lambda.Handler
+}
+
+// Option is an option of NewServer.
+type Option func(*serverOptions)
+
+// WithStage sets the stage that Server.Dial connects to.
+func WithStage(stage string, stageVariables map[string]string) Option {
+	return func(o *serverOptions) {
+		o.stage = stage
+		o.stageVariables = stageVariables
+	}
+}
+
+// WithTimeout sets timeout of Client.Expect and Client.ExpectClose.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *serverOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithBridge sets the function to configure WebsocketHTTPBridgeHandler, for example SetAuthorizer or SetRouteKeySelector.
+// use WithLambdaHandler instead of SetLambdaHandler, connections invoked by lambda.Handler set by SetLambdaHandler are not tracked.
+func WithBridge(configure func(*elevate.WebsocketHTTPBridgeHandler)) Option {
+	return func(o *serverOptions) {
+		o.configure = append(o.configure, configure)
+	}
+}
+
+// WithLambdaHandler sets lambda.Handler to invoke instead of the handler of NewServer, for example elevate.NewLambdaHandler.
+// connections are tracked from the payload and the response of Lambda invocation.
+func WithLambdaHandler(handler lambda.Handler) Option {
+	return func(o *serverOptions) {
+		o.lambdaHandler = handler
+	}
+}
+
+// Server is a local WebSocket API served by WebsocketHTTPBridgeHandler on ephemeral listener.
+type Server struct {
+	// URL is the websocket URL of the stage, like ws://127.0.0.1:12345/develop .
+	URL string
+	// CallbackURL is the endpoint of @connections API, use with elevate.ContextWithCallbackURL in background workers.
+	CallbackURL string
+	// Bridge is the bridge handler of the Server.
+	Bridge *elevate.WebsocketHTTPBridgeHandler
+
+	httpServer  *httptest.Server
+	timeout     time.Duration
+	mu          sync.Mutex
+	connections map[string]bool
+	clients     map[string]string
+	dialed      []*Client
+	posts       []Post
+}
+
+// NewServer starts and returns a new Server with the handler. the caller should call Close when finished.
+func NewServer(handler http.Handler, opts ...Option) *Server {
+	o := serverOptions{
+		timeout: DefaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	s := &Server{
+		timeout:     o.timeout,
+		connections: make(map[string]bool),
+		clients:     make(map[string]string),
+	}
+	s.Bridge = elevate.NewWebsocketHTTPBridgeHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s.serveEvent(handler, w, req)
+	}))
+	if o.stage != "" {
+		s.Bridge.SetStage(o.stage, o.stageVariables)
+	}
+	for _, configure := range o.configure {
+		configure(s.Bridge)
+	}
+	if o.lambdaHandler != nil {
+		s.Bridge.SetLambdaHandler(&trackingLambdaHandler{server: s, handler: o.lambdaHandler})
+	}
+	s.httpServer = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.Bridge.SetCallbackURL(s.httpServer.URL)
+	s.URL = "ws" + strings.TrimPrefix(s.httpServer.URL, "http") + "/" + o.stage
+	s.CallbackURL = s.httpServer.URL
+	if o.stage != "" {
+		s.CallbackURL += "/" + o.stage
+	}
+	return s
+}
+
+// Close shuts down the Server, live connections are closed and $disconnect is fired.
+func (s *Server) Close() {
+	s.mu.Lock()
+	dialed := s.dialed
+	s.dialed = nil
+	s.mu.Unlock()
+	for _, c := range dialed {
+		c.Close()
+	}
+	ctx, cancel := contextWithTimeout(s.timeout)
+	defer cancel()
+	s.Bridge.Shutdown(ctx)
+	s.httpServer.Close()
+}
+
+// serveEvent calls the handler and tracks connections.
+func (s *Server) serveEvent(handler http.Handler, w http.ResponseWriter, req *http.Request) {
+	recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+	handler.ServeHTTP(recorder, req)
+	s.track(elevate.RouteKey(req), elevate.ConnectionID(req), clientIDFromContext(req.Context()), recorder.statusCode)
+}
+
+// track records the connection by the event and the status code of the handler.
+func (s *Server) track(routeKey, connectionID, clientID string, statusCode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch routeKey {
+	case elevate.RouteKeyConnect:
+		if statusCode != http.StatusOK {
+			return
+		}
+		s.connections[connectionID] = true
+		if clientID != "" {
+			s.clients[clientID] = connectionID
+		}
+	case elevate.RouteKeyDisconnect:
+		delete(s.connections, connectionID)
+		for clientID, id := range s.clients {
+			if id == connectionID {
+				delete(s.clients, clientID)
+			}
+		}
+	}
+}
+
+// trackingLambdaHandler invokes lambda.Handler and tracks connections from the payload and the response.
+type trackingLambdaHandler struct {
+	server  *Server
+	handler lambda.Handler
+}
+
+func (h *trackingLambdaHandler) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	out, err := h.handler.Invoke(ctx, payload)
+	if err != nil {
+		return out, err
+	}
+	var event events.APIGatewayWebsocketProxyRequest
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return out, nil
+	}
+	var resp events.APIGatewayProxyResponse
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return out, nil
+	}
+	h.server.track(event.RequestContext.RouteKey, event.RequestContext.ConnectionID, clientIDFromContext(ctx), resp.StatusCode)
+	return out, nil
+}
+
+// serveHTTP passes the request to the bridge and records @connections API POST delivered to the connection.
+// HTTPHeaderClientID of the upgrade request is moved into the context, the bridge passes it to $connect.
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	if clientID := req.Header.Get(HTTPHeaderClientID); clientID != "" {
+		req = req.Clone(context.WithValue(req.Context(), clientIDContextKey{}, clientID))
+		req.Header.Del(HTTPHeaderClientID)
+	}
+	_, connectionID, ok := strings.Cut(req.URL.Path, "/@connections/")
+	if !ok || req.Method != http.MethodPost {
+		s.Bridge.ServeHTTP(w, req)
+		return
+	}
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+	s.Bridge.ServeHTTP(recorder, req)
+	if recorder.statusCode != http.StatusOK {
+		// for example 410 GoneException, 403 ForbiddenException or 413 PayloadTooLargeException.
+		return
+	}
+	s.mu.Lock()
+	s.posts = append(s.posts, Post{ConnectionID: connectionID, Data: data})
+	s.mu.Unlock()
+}
+
+// Connections returns sorted connection ids of live connections.
+func (s *Server) Connections() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.connections))
+	for id := range s.connections {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Posts returns @connections API POST requests delivered to the connections by the Server, in received order.
+func (s *Server) Posts() []Post {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Post(nil), s.posts...)
+}
+
+// PostsTo returns data posted to the connection by @connections API, in received order.
+func (s *Server) PostsTo(connectionID string) [][]byte {
+	var data [][]byte
+	for _, post := range s.Posts() {
+		if post.ConnectionID == connectionID {
+			data = append(data, post.Data)
+		}
+	}
+	return data
+}
+
+// AssertPosted reports error if data is not posted to the connection by @connections API.
+func (s *Server) AssertPosted(t testing.TB, connectionID string, data string) {
+	t.Helper()
+	for _, posted := range s.PostsTo(connectionID) {
+		if string(posted) == data {
+			return
+		}
+	}
+	t.Errorf("elevatetest: `%s` is not posted to %s", data, connectionID)
+}
+
+// AssertNotPosted reports error if any data is posted to the connection by @connections API.
+func (s *Server) AssertNotPosted(t testing.TB, connectionID string) {
+	t.Helper()
+	if posts := s.PostsTo(connectionID); len(posts) > 0 {
+		t.Errorf("elevatetest: %d messages are posted to %s; want none", len(posts), connectionID)
+	}
+}
+
+func (s *Server) connectionIDOf(clientID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clients[clientID]
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(statusCode int) {
+	// superfluous calls are ignored, same as net/http.
+	if !r.wroteHeader {
+		r.statusCode = statusCode
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
@@ -13,72 +13,97 @@ import (
 	"github.com/mashiike/elevate"
 )
 
-var connections map[string]string = make(map[string]string)
+var store = elevate.NewInMemoryConnectionStore()
 
-func handler(w http.ResponseWriter, req *http.Request) {
+func nameOf(ctx context.Context, connectionID string) string {
+	conn, err := store.Get(ctx, connectionID)
+	if err != nil {
+		return "no name:" + connectionID
+	}
+	return conn.Attributes["name"]
+}
+
+func onConnect(w http.ResponseWriter, req *http.Request) {
 	connectionID := elevate.ConnectionID(req)
-	switch elevate.RouteKey(req) {
-	case "$connect":
-		broadcast(req.Context(), []byte("Join member: "+connectionID))
-		connections[connectionID] = "no name:" + connectionID
-		slog.Info("join member", "connectionID", connectionID, "remoteAddr", req.RemoteAddr, "current", len(connections))
-	case "$disconnect":
-		name, ok := connections[connectionID]
-		if !ok {
-			return
-		}
-		delete(connections, connectionID)
-		broadcast(req.Context(), []byte("Leave member: "+name))
-		slog.Info("leave member", "connectionID", connectionID, "remoteAddr", req.RemoteAddr, "current", len(connections))
-	case "$default":
-		bs, err := io.ReadAll(req.Body)
-		if err != nil {
-			slog.Error("read body failed", "detail", err)
+	broadcast(req.Context(), []byte("Join member: "+connectionID))
+	slog.Info("join member", "connectionID", connectionID, "remoteAddr", req.RemoteAddr)
+}
+
+func onDisconnect(w http.ResponseWriter, req *http.Request) {
+	connectionID := elevate.ConnectionID(req)
+	name := nameOf(req.Context(), connectionID)
+	broadcast(req.Context(), []byte("Leave member: "+name))
+	slog.Info("leave member", "connectionID", connectionID, "remoteAddr", req.RemoteAddr)
+}
+
+func onDefault(w http.ResponseWriter, req *http.Request) {
+	connectionID := elevate.ConnectionID(req)
+	bs, err := io.ReadAll(req.Body)
+	if err != nil {
+		slog.Error("read body failed", "detail", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	slog.Info("default", "connectionID", connectionID, "remoteAddr", req.RemoteAddr, "body", string(bs))
+	if bytes.EqualFold(bs, []byte("exit")) {
+		if err := elevate.DeleteConnection(req.Context(), connectionID); err != nil {
+			slog.Error("delete connection failed", "detail", err)
 			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		slog.Info("default", "connectionID", connectionID, "remoteAddr", req.RemoteAddr, "body", string(bs))
-		if bytes.EqualFold(bs, []byte("exit")) {
-			if err := elevate.DeleteConnection(req.Context(), connectionID); err != nil {
-				slog.Error("delete connection failed", "detail", err)
-				w.WriteHeader(http.StatusInternalServerError)
-			}
-			return
-		}
-		name := connections[connectionID]
-		msg := fmt.Sprintf("[%s] %s", name, string(bs))
-		broadcast(req.Context(), []byte(msg))
-	case "hello":
-		var data map[string]interface{}
-		err := json.NewDecoder(req.Body).Decode(&data)
-		if err != nil {
-			slog.Error("unmarshal failed", "detail", err)
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		name, ok := data["name"].(string)
-		if !ok {
-			return
 		}
-		slog.Info("hello", "connectionID", connectionID, "remoteAddr", req.RemoteAddr, "name", name)
-		msg := fmt.Sprintf("[%s] Hello!, my name is %s", connections[connectionID], name)
-		broadcast(req.Context(), []byte(msg))
-		connections[connectionID] = name
+		return
+	}
+	msg := fmt.Sprintf("[%s] %s", nameOf(req.Context(), connectionID), string(bs))
+	broadcast(req.Context(), []byte(msg))
+}
+
+func onHello(w http.ResponseWriter, req *http.Request) {
+	connectionID := elevate.ConnectionID(req)
+	var data map[string]interface{}
+	err := json.NewDecoder(req.Body).Decode(&data)
+	if err != nil {
+		slog.Error("unmarshal failed", "detail", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	name, ok := data["name"].(string)
+	if !ok {
+		return
+	}
+	slog.Info("hello", "connectionID", connectionID, "remoteAddr", req.RemoteAddr, "name", name)
+	msg := fmt.Sprintf("[%s] Hello!, my name is %s", nameOf(req.Context(), connectionID), name)
+	broadcast(req.Context(), []byte(msg))
+	err = store.Put(req.Context(), &elevate.Connection{
+		ConnectionID: connectionID,
+		ConnectedAt:  elevate.ConnectedAt(req),
+		Attributes:   map[string]string{"name": name},
+	})
+	if err != nil {
+		slog.Error("put connection failed", "detail", err)
+		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
 
 func broadcast(ctx context.Context, msg []byte) {
-	for k := range connections {
-		err := elevate.PostToConnection(ctx, k, msg)
-		if err != nil {
-			slog.Debug("post to failed", "detail", err, "connectionID", k)
-			if !elevate.ConnectionIsGone(err) {
-				slog.Error("post to failed", "detail", err, "connectionID", k)
-			} else {
-				slog.Warn("connection is gone", "connectionID", k)
-				delete(connections, k)
-			}
-		}
+	conns, err := store.List(ctx)
+	if err != nil {
+		slog.Error("list connections failed", "detail", err)
+		return
+	}
+	ids := make([]string, 0, len(conns))
+	for _, conn := range conns {
+		ids = append(ids, conn.ConnectionID)
+	}
+	// gone connections are pruned from store automatically.
+	result, err := elevate.Broadcast(ctx, ids, msg)
+	if err != nil {
+		slog.Error("broadcast failed", "detail", err)
+		return
+	}
+	for _, id := range result.Gone {
+		slog.Warn("connection is gone", "connectionID", id)
+	}
+	for id, err := range result.Failed {
+		slog.Error("post to failed", "detail", err, "connectionID", id)
 	}
 }
 
@@ -88,8 +113,17 @@ func main() {
 			Level: slog.LevelDebug,
 		}),
 	))
+	mux := elevate.NewRouteMux()
+	mux.HandleConnect(http.HandlerFunc(onConnect))
+	mux.HandleDisconnect(http.HandlerFunc(onDisconnect))
+	mux.HandleDefault(http.HandlerFunc(onDefault))
+	mux.HandleFunc("hello", onHello)
+	handler := elevate.NewConnectionStoreHandler(store, mux)
+	handler.SetAttributesFunc(func(req *http.Request) map[string]string {
+		return map[string]string{"name": "no name:" + elevate.ConnectionID(req)}
+	})
 	err := elevate.RunWithOptions(
-		http.HandlerFunc(handler),
+		handler,
 		elevate.WithLocalAdress(":8080"),
 		elevate.WithVerbose(),
 	)
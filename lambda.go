@@ -0,0 +1,168 @@
+package elevate
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/google/uuid"
+)
+
+// runtimeInterfaceEmulatorPath is the invocation path of Lambda Runtime Interface Emulator.
+const runtimeInterfaceEmulatorPath = "/2015-03-31/functions/function/invocations"
+
+// DefaultRuntimeInterfaceEmulatorTimeout is a default timeout of the invocation on Lambda Runtime Interface Emulator,
+// same as the integration timeout of API Gateway.
+var DefaultRuntimeInterfaceEmulatorTimeout = 29 * time.Second
+
+// newLambdaHandler returns the handler of Lambda invocation, same as running on AWS Lambda Runtime.
+func newLambdaHandler(mux http.Handler, runOpts *runOptions) func(ctx context.Context, event json.RawMessage) (*events.APIGatewayProxyResponse, error) {
+	return func(ctx context.Context, event json.RawMessage) (*events.APIGatewayProxyResponse, error) {
+		if runOpts.varbose {
+			runOpts.logger.DebugContext(ctx, "lambda invoked", "event", string(event))
+		}
+		if runOpts.awsConfig != nil {
+			ctx = ContextWithAWSConfig(ctx, *runOpts.awsConfig)
+		}
+		if runOpts.callbackURL != "" {
+			ctx = ContextWithCallbackURL(ctx, runOpts.callbackURL)
+		}
+		if runOpts.mgmtClient != nil {
+			ctx = ContextWithManagementAPIClient(ctx, runOpts.mgmtClient)
+		}
+		req, err := NewRequestWithContext(ctx, event)
+		if err != nil {
+			return nil, err
+		}
+		w := &ResponseWriter{
+			header: make(http.Header),
+		}
+		mux.ServeHTTP(w, req)
+		return w.Response(), nil
+	}
+}
+
+// NewLambdaHandler returns lambda.Handler of the mux, same as RunWithOptions starts on AWS Lambda Runtime.
+// the payload is decoded by NewRequestWithContext and the response is encoded by ResponseWriter.Response.
+// use it with WebsocketHTTPBridgeHandler.SetLambdaHandler to test Lambda code path locally.
+func NewLambdaHandler(mux http.Handler, options ...Option) lambda.Handler {
+	runOpts := defaultRunOptions()
+	for _, opt := range options {
+		opt(&runOpts)
+	}
+	return lambda.NewHandlerWithOptions(newLambdaHandler(mux, &runOpts), runOpts.lambdaOptions...)
+}
+
+// runtimeInterfaceEmulator is lambda.Handler that invokes the function on Lambda Runtime Interface Emulator.
+type runtimeInterfaceEmulator struct {
+	endpoint string
+	client   *http.Client
+	timeout  time.Duration
+}
+
+// NewRuntimeInterfaceEmulatorHandler returns lambda.Handler that invokes the function on Lambda Runtime Interface Emulator, for example `http://localhost:9000`.
+// the function should set the callback URL of local bridge by WithCallbackURL, it is not resolved from the event.
+// the invocation fails after DefaultRuntimeInterfaceEmulatorTimeout or the deadline of the context.
+func NewRuntimeInterfaceEmulatorHandler(endpoint string) lambda.Handler {
+	if u, err := url.Parse(endpoint); err == nil && strings.TrimSuffix(u.Path, "/") == "" {
+		u.Path = runtimeInterfaceEmulatorPath
+		endpoint = u.String()
+	}
+	return &runtimeInterfaceEmulator{
+		endpoint: endpoint,
+		client:   &http.Client{},
+		timeout:  DefaultRuntimeInterfaceEmulatorTimeout,
+	}
+}
+
+func (e *runtimeInterfaceEmulator) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	if e.timeout > 0 {
+		// hung emulator should not block $connect and messages of the bridge.
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("runtime interface emulator returns %s: %s", resp.Status, body)
+	}
+	var fnErr struct {
+		ErrorMessage string `json:"errorMessage"`
+		ErrorType    string `json:"errorType"`
+	}
+	if json.Unmarshal(body, &fnErr) == nil && (fnErr.ErrorType != "" || fnErr.ErrorMessage != "") {
+		return nil, fmt.Errorf("function error %s: %s", fnErr.ErrorType, fnErr.ErrorMessage)
+	}
+	return body, nil
+}
+
+// invokeLambda sends the proxy request to lambda.Handler as the payload of Lambda invocation.
+func (h *WebsocketHTTPBridgeHandler) invokeLambda(ctx context.Context, proxyReq *events.APIGatewayWebsocketProxyRequest) (*ResponseWriter, error) {
+	payload, err := marshalEvent(ctx, proxyReq)
+	if err != nil {
+		return nil, err
+	}
+	ctx = lambdacontext.NewContext(ctx, &lambdacontext.LambdaContext{
+		AwsRequestID: uuid.New().String(),
+	})
+	out, err := h.lambdaHandler.Invoke(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	var resp events.APIGatewayProxyResponse
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return nil, fmt.Errorf("invalid lambda response: %w", err)
+	}
+	return newResponseWriterFromResponse(&resp)
+}
+
+// newResponseWriterFromResponse returns ResponseWriter that has the response of Lambda invocation.
+func newResponseWriterFromResponse(resp *events.APIGatewayProxyResponse) (*ResponseWriter, error) {
+	if resp.StatusCode == 0 {
+		return nil, errors.New("invalid lambda response: statusCode is missing")
+	}
+	w := NewResponseWriter()
+	w.WriteHeader(resp.StatusCode)
+	for k, v := range resp.MultiValueHeaders {
+		for _, vv := range v {
+			w.header.Add(k, vv)
+		}
+	}
+	for k, v := range resp.Headers {
+		w.header.Set(k, v)
+	}
+	if resp.IsBase64Encoded {
+		body, err := base64.StdEncoding.DecodeString(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lambda response: %w", err)
+		}
+		w.Write(body)
+	} else {
+		w.WriteString(resp.Body)
+	}
+	return w, nil
+}
@@ -0,0 +1,143 @@
+package elevate_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/mashiike/elevate"
+	"github.com/mashiike/elevate/elevatetest"
+)
+
+func newLambdaTestHandler(t *testing.T, disconnected chan<- int) http.Handler {
+	mux := elevate.NewRouteMux()
+	mux.HandleConnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if elevate.QueryStringParameters(req)["name"] == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	mux.HandleDisconnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		code, _ := elevate.DisconnectReason(req)
+		disconnected <- code
+	}))
+	mux.HandleDefault(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		bs, err := io.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if string(bs) == "post" {
+			if err := elevate.PostToConnection(req.Context(), elevate.ConnectionID(req), []byte("posted")); err != nil {
+				t.Errorf("PostToConnection() error = %v; want nil", err)
+			}
+			w.Write([]byte("ok"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(bs)
+	}))
+	return mux
+}
+
+func TestNewLambdaHandler(t *testing.T) {
+	disconnected := make(chan int, 1)
+	inner := newLambdaTestHandler(t, disconnected)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, ok := lambdacontext.FromContext(req.Context()); !ok {
+			t.Error("lambda context is not found")
+		}
+		inner.ServeHTTP(w, req)
+	})
+	srv := elevatetest.NewServer(http.NotFoundHandler(), elevatetest.WithStage("develop", nil), elevatetest.WithLambdaHandler(elevate.NewLambdaHandler(handler)))
+	defer srv.Close()
+
+	if _, resp, err := srv.TryDial(t, nil, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("TryDial() without name = %v; want 401", err)
+	}
+	client := srv.Dial(t, map[string][]string{"name": {"alice"}}, nil)
+	if got := srv.Connections(); len(got) != 1 || got[0] != client.ConnectionID() {
+		t.Errorf("Connections() = %v; want [%s]", got, client.ConnectionID())
+	}
+	client.SendBinary([]byte{0x00, 0xff})
+	if got := client.Read(); string(got) != "\x00\xff" {
+		t.Errorf("message = %q; want binary echo", got)
+	}
+	client.Send("post")
+	client.Expect("posted")
+	client.Expect("ok")
+	srv.AssertPosted(t, client.ConnectionID(), "posted")
+	client.Close()
+	if code := <-disconnected; code != 1000 {
+		t.Errorf("disconnect status code = %d; want 1000", code)
+	}
+}
+
+func TestNewRuntimeInterfaceEmulatorHandler(t *testing.T) {
+	disconnected := make(chan int, 1)
+	lambdaHandler := elevate.NewLambdaHandler(newLambdaTestHandler(t, disconnected))
+	var failing atomic.Bool
+	rie := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/2015-03-31/functions/function/invocations" {
+			t.Errorf("path = %s; want invocations path", req.URL.Path)
+		}
+		if failing.Load() {
+			w.Write([]byte(`{"errorMessage":"boom","errorType":"errorString"}`))
+			return
+		}
+		payload, err := io.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		out, err := lambdaHandler.Invoke(req.Context(), payload)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(out)
+	}))
+	defer rie.Close()
+	srv := elevatetest.NewServer(http.NotFoundHandler(), elevatetest.WithLambdaHandler(elevate.NewRuntimeInterfaceEmulatorHandler(rie.URL)))
+	defer srv.Close()
+
+	client := srv.Dial(t, map[string][]string{"name": {"alice"}}, nil)
+	client.SendBinary([]byte("hello"))
+	client.Expect("hello")
+	client.Close()
+	<-disconnected
+
+	failing.Store(true)
+	if _, resp, err := srv.TryDial(t, map[string][]string{"name": {"bob"}}, nil); err == nil || resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("TryDial() with function error = %v; want 500", err)
+	}
+}
+
+func TestNewRuntimeInterfaceEmulatorHandler__Timeout(t *testing.T) {
+	release := make(chan struct{})
+	rie := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// hung emulator
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+	}))
+	defer rie.Close()
+	defer close(release)
+	timeout := elevate.DefaultRuntimeInterfaceEmulatorTimeout
+	elevate.DefaultRuntimeInterfaceEmulatorTimeout = 100 * time.Millisecond
+	defer func() { elevate.DefaultRuntimeInterfaceEmulatorTimeout = timeout }()
+	srv := elevatetest.NewServer(http.NotFoundHandler(), elevatetest.WithLambdaHandler(elevate.NewRuntimeInterfaceEmulatorHandler(rie.URL)))
+	defer srv.Close()
+
+	start := time.Now()
+	if _, resp, err := srv.TryDial(t, map[string][]string{"name": {"alice"}}, nil); err == nil || resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("TryDial() with hung emulator = %v; want 500", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("TryDial() took %s; want timeout of the invocation", elapsed)
+	}
+}
@@ -0,0 +1,107 @@
+package elevate
+
+import (
+	"net/http"
+	"sync"
+)
+
+const (
+	// RouteKeyConnect is a route key of $connect route.
+	RouteKeyConnect = "$connect"
+	// RouteKeyDisconnect is a route key of $disconnect route.
+	RouteKeyDisconnect = "$disconnect"
+	// RouteKeyDefault is a route key of $default route.
+	RouteKeyDefault = "$default"
+)
+
+// RouteMux is a route key multiplexer for API Gateway Websocket API.
+// It dispatches each request to the handler registered for elevate.RouteKey(req).
+// If no handler is registered for the route key, it falls back to the $default handler, same as API Gateway.
+// $connect and $disconnect without handler are accepted with 200 OK.
+type RouteMux struct {
+	mu       sync.RWMutex
+	handlers map[string]http.Handler
+}
+
+// NewRouteMux returns a new RouteMux.
+func NewRouteMux() *RouteMux {
+	return &RouteMux{
+		handlers: make(map[string]http.Handler),
+	}
+}
+
+// Handle registers the handler for the given route key.
+func (mux *RouteMux) Handle(routeKey string, handler http.Handler) {
+	if routeKey == "" {
+		panic("elevate: empty route key")
+	}
+	if handler == nil {
+		panic("elevate: nil handler")
+	}
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if mux.handlers == nil {
+		mux.handlers = make(map[string]http.Handler)
+	}
+	if _, exists := mux.handlers[routeKey]; exists {
+		panic("elevate: multiple registrations for route key " + routeKey)
+	}
+	mux.handlers[routeKey] = handler
+}
+
+// HandleFunc registers the handler function for the given route key.
+func (mux *RouteMux) HandleFunc(routeKey string, handler func(http.ResponseWriter, *http.Request)) {
+	if handler == nil {
+		panic("elevate: nil handler")
+	}
+	mux.Handle(routeKey, http.HandlerFunc(handler))
+}
+
+// HandleConnect registers the handler for $connect route.
+func (mux *RouteMux) HandleConnect(handler http.Handler) {
+	mux.Handle(RouteKeyConnect, handler)
+}
+
+// HandleDisconnect registers the handler for $disconnect route.
+func (mux *RouteMux) HandleDisconnect(handler http.Handler) {
+	mux.Handle(RouteKeyDisconnect, handler)
+}
+
+// HandleDefault registers the handler for $default route.
+func (mux *RouteMux) HandleDefault(handler http.Handler) {
+	mux.Handle(RouteKeyDefault, handler)
+}
+
+// Handler returns the handler to use for the given request and the route key that matched.
+// If no handler matches, returned handler is not nil, it responds 404 Not Found.
+func (mux *RouteMux) Handler(req *http.Request) (http.Handler, string) {
+	routeKey := RouteKey(req)
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+	if h, ok := mux.handlers[routeKey]; ok {
+		return h, routeKey
+	}
+	switch routeKey {
+	case RouteKeyConnect, RouteKeyDisconnect:
+		return http.HandlerFunc(acceptHandler), ""
+	}
+	if h, ok := mux.handlers[RouteKeyDefault]; ok {
+		return h, RouteKeyDefault
+	}
+	return http.HandlerFunc(notFoundHandler), ""
+}
+
+// ServeHTTP dispatches the request to the handler whose route key matches.
+func (mux *RouteMux) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h, _ := mux.Handler(req)
+	h.ServeHTTP(w, req)
+}
+
+func acceptHandler(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func notFoundHandler(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte(http.StatusText(http.StatusNotFound)))
+}
@@ -0,0 +1,117 @@
+package elevate_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mashiike/elevate"
+)
+
+func TestRouteMux(t *testing.T) {
+	mux := elevate.NewRouteMux()
+	mux.HandleConnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, "connect")
+	}))
+	mux.HandleFunc("hello", func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, "hello")
+	})
+	mux.HandleDefault(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, "default")
+	}))
+	cases := []struct {
+		file       string
+		wantStatus int
+		wantBody   string
+	}{
+		{file: "testdata/connect.json", wantStatus: http.StatusOK, wantBody: "connect"},
+		{file: "testdata/disconnect.json", wantStatus: http.StatusOK, wantBody: ""},
+		{file: "testdata/hello.json", wantStatus: http.StatusOK, wantBody: "hello"},
+		{file: "testdata/default.json", wantStatus: http.StatusOK, wantBody: "default"},
+	}
+	for _, c := range cases {
+		t.Run(c.file, func(t *testing.T) {
+			bs, err := os.ReadFile(c.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req, err := elevate.NewRequest(bs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := elevate.NewResponseWriter()
+			mux.ServeHTTP(w, req)
+			resp := w.Response()
+			if resp.StatusCode != c.wantStatus {
+				t.Errorf("resp.StatusCode = %d; want %d", resp.StatusCode, c.wantStatus)
+			}
+			if resp.Body != c.wantBody {
+				t.Errorf("resp.Body = %s; want %s", resp.Body, c.wantBody)
+			}
+		})
+	}
+}
+
+func TestRouteMux__NoDefault(t *testing.T) {
+	mux := elevate.NewRouteMux()
+	bs, err := os.ReadFile("testdata/hello.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := elevate.NewRequest(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := elevate.NewResponseWriter()
+	mux.ServeHTTP(w, req)
+	if resp := w.Response(); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("resp.StatusCode = %d; want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestRouteMux__WithBridge(t *testing.T) {
+	mux := elevate.NewRouteMux()
+	mux.HandleFunc("echo", func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, "echo:"+elevate.RouteKey(req))
+	})
+	mux.HandleDefault(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, "default:"+elevate.RouteKey(req))
+	}))
+	handler := elevate.NewWebsocketHTTPBridgeHandler(mux)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	handler.SetCallbackURL(server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, _, err := websocket.DefaultDialer.DialContext(ctx, "ws://"+server.Listener.Addr().String()+"/", nil)
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	defer c.Close()
+	cases := []struct {
+		msg  string
+		want string
+	}{
+		{msg: `{"action":"echo"}`, want: "echo:echo"},
+		{msg: `{"action":"unknown"}`, want: "default:unknown"},
+		{msg: `not json`, want: "default:$default"},
+	}
+	for _, c2 := range cases {
+		if err := c.WriteMessage(websocket.TextMessage, []byte(c2.msg)); err != nil {
+			t.Fatal("write:", err)
+		}
+		_, message, err := c.ReadMessage()
+		if err != nil {
+			t.Fatal("read:", err)
+		}
+		if string(message) != c2.want {
+			t.Errorf("message = %s; want %s", message, c2.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package elevate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Record is a line of JSONL written by WebsocketHTTPBridgeHandler.SetRecorder.
+// Event is the payload of Lambda invocation, and Response is the response of the handler.
+type Record struct {
+	Event    json.RawMessage                 `json:"event"`
+	Response *events.APIGatewayProxyResponse `json:"response"`
+}
+
+// sessionRecorder writes Record as JSONL, it is safe for concurrent use.
+type sessionRecorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (r *sessionRecorder) record(ctx context.Context, proxyReq *events.APIGatewayWebsocketProxyRequest, resp *events.APIGatewayProxyResponse) error {
+	event, err := marshalEvent(ctx, proxyReq)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.enc.Encode(Record{Event: event, Response: resp})
+}
+
+// marshalEvent returns the payload of Lambda invocation, with disconnect status in context.
+func marshalEvent(ctx context.Context, proxyReq *events.APIGatewayWebsocketProxyRequest) (json.RawMessage, error) {
+	return MarshalProxyRequest(proxyReq, disconnectStatusFromContext(ctx))
+}
+
+// MarshalProxyRequest returns the payload of Lambda invocation, requestContext has the disconnect status of $disconnect event.
+// it is the same format as the recording of SetRecorder and the event that API Gateway sends.
+func MarshalProxyRequest(proxyReq *events.APIGatewayWebsocketProxyRequest, status DisconnectStatus) (json.RawMessage, error) {
+	type requestContext struct {
+		events.APIGatewayWebsocketProxyRequestContext
+		DisconnectStatus
+	}
+	return json.Marshal(struct {
+		*events.APIGatewayWebsocketProxyRequest
+		RequestContext requestContext `json:"requestContext"`
+	}{
+		APIGatewayWebsocketProxyRequest: proxyReq,
+		RequestContext: requestContext{
+			APIGatewayWebsocketProxyRequestContext: proxyReq.RequestContext,
+			DisconnectStatus:                       status,
+		},
+	})
+}
+
+// ReplayDiff is a difference between recorded response and replayed response.
+type ReplayDiff struct {
+	// Line is the line number of the record in the recording.
+	Line         int
+	RouteKey     string
+	ConnectionID string
+	Recorded     *events.APIGatewayProxyResponse
+	Replayed     *events.APIGatewayProxyResponse
+}
+
+func (d ReplayDiff) String() string {
+	return fmt.Sprintf("line %d %s (%s): %s", d.Line, d.RouteKey, d.ConnectionID, strings.Join(diffResponse(d.Recorded, d.Replayed), ", "))
+}
+
+// diffResponse returns descriptions of differences between recorded and replayed response.
+func diffResponse(recorded, replayed *events.APIGatewayProxyResponse) []string {
+	var diffs []string
+	if recorded.StatusCode != replayed.StatusCode {
+		diffs = append(diffs, fmt.Sprintf("statusCode: %d -> %d", recorded.StatusCode, replayed.StatusCode))
+	}
+	if recorded.IsBase64Encoded != replayed.IsBase64Encoded {
+		diffs = append(diffs, fmt.Sprintf("isBase64Encoded: %v -> %v", recorded.IsBase64Encoded, replayed.IsBase64Encoded))
+	}
+	if recorded.Body != replayed.Body {
+		diffs = append(diffs, fmt.Sprintf("body: %q -> %q", recorded.Body, replayed.Body))
+	}
+	if (len(recorded.MultiValueHeaders) > 0 || len(replayed.MultiValueHeaders) > 0) &&
+		!reflect.DeepEqual(recorded.MultiValueHeaders, replayed.MultiValueHeaders) {
+		diffs = append(diffs, fmt.Sprintf("headers: %v -> %v", recorded.MultiValueHeaders, replayed.MultiValueHeaders))
+	}
+	return diffs
+}
+
+// Replay feeds recorded events to the handler through Lambda code path in order, and returns differences of responses.
+// the handler calls @connections API with the recorded connection ids, inject ManagementAPIClient into ctx to capture them.
+func Replay(ctx context.Context, handler http.Handler, r io.Reader) ([]ReplayDiff, error) {
+	var diffs []ReplayDiff
+	dec := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var rec Record
+		if err := dec.Decode(&rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				return diffs, nil
+			}
+			return diffs, fmt.Errorf("line %d: %w", line, err)
+		}
+		req, err := NewRequestWithContext(ctx, rec.Event)
+		if err != nil {
+			return diffs, fmt.Errorf("line %d: %w", line, err)
+		}
+		w := NewResponseWriter()
+		handler.ServeHTTP(w, req)
+		replayed := w.Response()
+		if rec.Response == nil {
+			continue
+		}
+		if len(diffResponse(rec.Response, replayed)) > 0 {
+			diffs = append(diffs, ReplayDiff{
+				Line:         line,
+				RouteKey:     RouteKey(req),
+				ConnectionID: ConnectionID(req),
+				Recorded:     rec.Response,
+				Replayed:     replayed,
+			})
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package elevate_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/mashiike/elevate"
+	"github.com/mashiike/elevate/elevatetest"
+)
+
+func newEchoHandler(transform func(string) string) http.Handler {
+	mux := elevate.NewRouteMux()
+	mux.HandleConnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	mux.HandleDisconnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	mux.HandleDefault(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		bs, err := io.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(transform(string(bs))))
+	}))
+	return mux
+}
+
+func TestReplay(t *testing.T) {
+	var recording bytes.Buffer
+	srv := elevatetest.NewServer(newEchoHandler(strings.ToUpper), elevatetest.WithBridge(func(bridge *elevate.WebsocketHTTPBridgeHandler) {
+		bridge.SetRecorder(&recording)
+	}))
+	client := srv.Dial(t, url.Values{"name": {"alice"}}, nil)
+	client.Send("hello")
+	client.Expect("HELLO")
+	srv.Close()
+
+	var records []elevate.Record
+	scanner := bufio.NewScanner(bytes.NewReader(recording.Bytes()))
+	for scanner.Scan() {
+		var rec elevate.Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("invalid record `%s`: %v", scanner.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 3 {
+		t.Fatalf("len(records) = %d; want 3", len(records))
+	}
+	for i, routeKey := range []string{elevate.RouteKeyConnect, elevate.RouteKeyDefault, elevate.RouteKeyDisconnect} {
+		req, err := elevate.NewRequest(records[i].Event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := elevate.RouteKey(req); got != routeKey {
+			t.Errorf("records[%d] route key = %s; want %s", i, got, routeKey)
+		}
+		if routeKey == elevate.RouteKeyDisconnect {
+			if code, _ := elevate.DisconnectReason(req); code == 0 {
+				t.Errorf("records[%d] disconnect status code is not recorded", i)
+			}
+		}
+	}
+
+	diffs, err := elevate.Replay(context.Background(), newEchoHandler(strings.ToUpper), bytes.NewReader(recording.Bytes()))
+	if err != nil {
+		t.Fatalf("Replay() error = %v; want nil", err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("Replay() diffs = %v; want none", diffs)
+	}
+	diffs, err = elevate.Replay(context.Background(), newEchoHandler(strings.ToLower), bytes.NewReader(recording.Bytes()))
+	if err != nil {
+		t.Fatalf("Replay() error = %v; want nil", err)
+	}
+	if len(diffs) != 1 || diffs[0].Line != 2 || diffs[0].Replayed.Body != "hello" {
+		t.Errorf("Replay() diffs = %v; want body diff on line 2", diffs)
+	}
+}
+
+func TestMarshalProxyRequest(t *testing.T) {
+	proxyReq := elevatetest.DisconnectEvent(0, "").WithConnectionID("ZZZZZZZZZZZZZZZ=").ProxyRequest()
+	payload, err := elevate.MarshalProxyRequest(&proxyReq, elevate.DisconnectStatus{StatusCode: 1001, Reason: "Going away"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := elevate.NewRequest(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := elevate.ConnectionID(req); got != "ZZZZZZZZZZZZZZZ=" {
+		t.Errorf("ConnectionID() = %s; want ZZZZZZZZZZZZZZZ=", got)
+	}
+	if code, reason := elevate.DisconnectReason(req); code != 1001 || reason != "Going away" {
+		t.Errorf("DisconnectReason() = %d, %s; want 1001, Going away", code, reason)
+	}
+	if want := elevatetest.DisconnectEvent(1001, "Going away").WithConnectionID("ZZZZZZZZZZZZZZZ=").JSON(); !bytes.Contains(want, []byte(`"disconnectStatusCode":1001`)) {
+		t.Errorf("Event.JSON() = %s; want disconnectStatusCode", want)
+	}
+}
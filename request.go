@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 )
@@ -41,6 +42,82 @@ func EventType(r *http.Request) string {
 	return r.Header.Get(HTTPHeaderEventType)
 }
 
+// AuthorizerContext returns requestContext.authorizer from *http.Request.
+// it contains principalId and context returned by Lambda REQUEST authorizer.
+func AuthorizerContext(r *http.Request) map[string]interface{} {
+	if v, ok := ProxyRequestContext(r.Context()).Authorizer.(map[string]interface{}); ok {
+		return v
+	}
+	return nil
+}
+
+// PrincipalID returns principalId of authorizer from *http.Request.
+func PrincipalID(r *http.Request) string {
+	if v, ok := AuthorizerContext(r)["principalId"].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// StageVariables returns stage variables from *http.Request.
+func StageVariables(r *http.Request) map[string]string {
+	return stageVariablesFromContext(r.Context())
+}
+
+// Stage returns stage name from *http.Request.
+func Stage(r *http.Request) string {
+	return ProxyRequestContext(r.Context()).Stage
+}
+
+// ConnectedAt returns the time when the connection was established from *http.Request.
+func ConnectedAt(r *http.Request) time.Time {
+	connectedAt := ProxyRequestContext(r.Context()).ConnectedAt
+	if connectedAt == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(connectedAt)
+}
+
+// SourceIP returns source ip address of the client from *http.Request.
+func SourceIP(r *http.Request) string {
+	return ProxyRequestContext(r.Context()).Identity.SourceIP
+}
+
+// QueryStringParameters returns query string parameters of $connect request from *http.Request.
+// if the parameter has multiple values, it returns the last one, same as API Gateway.
+func QueryStringParameters(r *http.Request) map[string]string {
+	params := queryStringParametersFromContext(r.Context())
+	if params == nil {
+		return nil
+	}
+	ret := make(map[string]string, len(params))
+	for k, v := range params {
+		if len(v) > 0 {
+			ret[k] = v[len(v)-1]
+		}
+	}
+	return ret
+}
+
+// MultiValueQueryStringParameters returns query string parameters of $connect request from *http.Request.
+func MultiValueQueryStringParameters(r *http.Request) map[string][]string {
+	return queryStringParametersFromContext(r.Context())
+}
+
+// DisconnectReason returns requestContext.disconnectStatusCode and requestContext.disconnectReason from *http.Request.
+// it is set only for $disconnect, for example 1001 and "Going away" on idle timeout.
+func DisconnectReason(r *http.Request) (int, string) {
+	reason := disconnectStatusFromContext(r.Context())
+	return reason.StatusCode, reason.Reason
+}
+
+// DisconnectStatus is a part of requestContext of $disconnect event, events.APIGatewayWebsocketProxyRequestContext does not have these fields.
+// embed it with events.APIGatewayWebsocketProxyRequestContext to marshal requestContext of the event.
+type DisconnectStatus struct {
+	StatusCode int    `json:"disconnectStatusCode,omitempty"`
+	Reason     string `json:"disconnectReason,omitempty"`
+}
+
 // NewRequest creates *net/http.Request from a Request.
 func NewRequest(event json.RawMessage) (*http.Request, error) {
 	return NewRequestWithContext(context.Background(), event)
@@ -56,6 +133,19 @@ func NewRequestWithContext(ctx context.Context, event json.RawMessage) (*http.Re
 	if err := dec.Decode(&proxyReq); err != nil {
 		return nil, err
 	}
+	var disconnectEvent struct {
+		RequestContext DisconnectStatus `json:"requestContext"`
+	}
+	if err := json.Unmarshal(event, &disconnectEvent); err != nil {
+		return nil, err
+	}
+	if disconnectEvent.RequestContext != (DisconnectStatus{}) {
+		ctx = contextWithDisconnectStatus(ctx, disconnectEvent.RequestContext)
+	}
+	return newRequestFromProxyRequest(ctx, &proxyReq)
+}
+
+func newRequestFromProxyRequest(ctx context.Context, proxyReq *events.APIGatewayWebsocketProxyRequest) (*http.Request, error) {
 	header := make(http.Header)
 	for k, v := range proxyReq.MultiValueHeaders {
 		for _, vv := range v {
@@ -72,15 +162,16 @@ func NewRequestWithContext(ctx context.Context, event json.RawMessage) (*http.Re
 	if header.Get(HTTPHeaderRequestID) == "" {
 		header.Set(HTTPHeaderRequestID, proxyReq.RequestContext.RequestID)
 	}
-
+	params := multiValueQueryStringParameters(proxyReq)
 	u := url.URL{
-		Scheme: "ws",
-		Host:   proxyReq.RequestContext.DomainName,
-		Path:   proxyReq.RequestContext.RouteKey,
+		Scheme:   "ws",
+		Host:     proxyReq.RequestContext.DomainName,
+		Path:     proxyReq.RequestContext.RouteKey,
+		RawQuery: url.Values(params).Encode(),
 	}
 	var b io.Reader
 	if proxyReq.IsBase64Encoded {
-		raw := make([]byte, len(proxyReq.Body))
+		raw := make([]byte, base64.StdEncoding.DecodedLen(len(proxyReq.Body)))
 		n, err := base64.StdEncoding.Decode(raw, []byte(proxyReq.Body))
 		if err != nil {
 			return nil, err
@@ -90,6 +181,12 @@ func NewRequestWithContext(ctx context.Context, event json.RawMessage) (*http.Re
 		b = strings.NewReader(proxyReq.Body)
 	}
 	ctx = contextWithRequestContext(ctx, proxyReq.RequestContext)
+	if proxyReq.StageVariables != nil {
+		ctx = contextWithStageVariables(ctx, proxyReq.StageVariables)
+	}
+	if params != nil {
+		ctx = contextWithQueryStringParameters(ctx, params)
+	}
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), b)
 	if err != nil {
 		return nil, err
@@ -98,3 +195,19 @@ func NewRequestWithContext(ctx context.Context, event json.RawMessage) (*http.Re
 	req.RemoteAddr = proxyReq.RequestContext.Identity.SourceIP
 	return req, nil
 }
+
+func multiValueQueryStringParameters(proxyReq *events.APIGatewayWebsocketProxyRequest) map[string][]string {
+	if proxyReq.MultiValueQueryStringParameters == nil && proxyReq.QueryStringParameters == nil {
+		return nil
+	}
+	params := make(map[string][]string, len(proxyReq.MultiValueQueryStringParameters))
+	for k, v := range proxyReq.MultiValueQueryStringParameters {
+		params[k] = append([]string(nil), v...)
+	}
+	for k, v := range proxyReq.QueryStringParameters {
+		if _, ok := params[k]; !ok {
+			params[k] = []string{v}
+		}
+	}
+	return params
+}
@@ -2,8 +2,11 @@ package elevate_test
 
 import (
 	"io"
+	"net/url"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/mashiike/elevate"
 )
@@ -143,6 +146,13 @@ func TestNewRequest__Disconnect(t *testing.T) {
 	if proxyCtx.Stage != "develop" {
 		t.Errorf("proxyCtx.Stage = %s; want develop", proxyCtx.Stage)
 	}
+	code, reason := elevate.DisconnectReason(req)
+	if code != 1005 {
+		t.Errorf("DisconnectReason() code = %d; want 1005", code)
+	}
+	if reason != "Client-side close frame status not set" {
+		t.Errorf("DisconnectReason() reason = %s; want Client-side close frame status not set", reason)
+	}
 }
 
 func TestNewRequest__Default(t *testing.T) {
@@ -260,3 +270,64 @@ func TestNewRequest__RouteHello(t *testing.T) {
 		t.Errorf("proxyCtx.Stage = %s; want develop", proxyCtx.Stage)
 	}
 }
+
+func TestNewRequest__Accessors(t *testing.T) {
+	bs, err := os.ReadFile("testdata/connect_with_authorizer.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := elevate.NewRequest(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := elevate.PrincipalID(req); got != "user-0001" {
+		t.Errorf("elevate.PrincipalID(req) = %s; want user-0001", got)
+	}
+	if got := elevate.AuthorizerContext(req)["role"]; got != "member" {
+		t.Errorf("elevate.AuthorizerContext(req)[\"role\"] = %v; want member", got)
+	}
+	if got := elevate.Stage(req); got != "develop" {
+		t.Errorf("elevate.Stage(req) = %s; want develop", got)
+	}
+	if got := elevate.StageVariables(req)["tableName"]; got != "connections-develop" {
+		t.Errorf("elevate.StageVariables(req)[\"tableName\"] = %s; want connections-develop", got)
+	}
+	if got := elevate.ConnectedAt(req); !got.Equal(time.UnixMilli(1703610495030)) {
+		t.Errorf("elevate.ConnectedAt(req) = %s; want %s", got, time.UnixMilli(1703610495030))
+	}
+	if got := elevate.SourceIP(req); got != "192.168.1.1" {
+		t.Errorf("elevate.SourceIP(req) = %s; want 192.168.1.1", got)
+	}
+	if got := elevate.QueryStringParameters(req); !reflect.DeepEqual(got, map[string]string{"room": "abc", "tag": "b"}) {
+		t.Errorf("elevate.QueryStringParameters(req) = %v; want map[room:abc tag:b]", got)
+	}
+	if got := elevate.MultiValueQueryStringParameters(req)["tag"]; !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("elevate.MultiValueQueryStringParameters(req)[\"tag\"] = %v; want [a b]", got)
+	}
+	if got := req.URL.Query(); !reflect.DeepEqual(got, url.Values{"room": {"abc"}, "tag": {"a", "b"}}) {
+		t.Errorf("req.URL.Query() = %v; want map[room:[abc] tag:[a b]]", got)
+	}
+}
+
+func TestNewRequest__AccessorsWithoutAuthorizer(t *testing.T) {
+	bs, err := os.ReadFile("testdata/default.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := elevate.NewRequest(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := elevate.PrincipalID(req); got != "" {
+		t.Errorf("elevate.PrincipalID(req) = %s; want empty", got)
+	}
+	if got := elevate.AuthorizerContext(req); got != nil {
+		t.Errorf("elevate.AuthorizerContext(req) = %v; want nil", got)
+	}
+	if got := elevate.StageVariables(req); got != nil {
+		t.Errorf("elevate.StageVariables(req) = %v; want nil", got)
+	}
+	if got := elevate.QueryStringParameters(req); got != nil {
+		t.Errorf("elevate.QueryStringParameters(req) = %v; want nil", got)
+	}
+}
@@ -0,0 +1,196 @@
+package elevate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RouteSelectionExpression parses API Gateway route selection expression and returns RouteKeySelector. for local.
+//
+// supported expressions are:
+//   - `$request.body.action`
+//   - `$request.body.message.type` , nested JSON path
+//   - `$request.body.items[0].type` , array index
+//   - `${request.body.service}/${request.body.op}` , literal concatenation
+//
+// the returned RouteKeySelector returns error if the body is not JSON object or the selected value is missing.
+// in this case, the bridge fallbacks to $default route, same as API Gateway.
+func RouteSelectionExpression(expr string) (RouteKeySelector, error) {
+	parts, err := parseRouteSelectionExpression(expr)
+	if err != nil {
+		return nil, fmt.Errorf("elevate: invalid route selection expression %q: %w", expr, err)
+	}
+	return func(body []byte) (string, error) {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return "", err
+		}
+		var sb strings.Builder
+		for _, p := range parts {
+			if p.path == nil {
+				sb.WriteString(p.literal)
+				continue
+			}
+			s, err := p.path.selectString(v)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(s)
+		}
+		return sb.String(), nil
+	}, nil
+}
+
+// MustRouteSelectionExpression is like RouteSelectionExpression but panics if the expression cannot be parsed.
+func MustRouteSelectionExpression(expr string) RouteKeySelector {
+	selector, err := RouteSelectionExpression(expr)
+	if err != nil {
+		panic(err)
+	}
+	return selector
+}
+
+type routeSelectionPart struct {
+	literal string
+	path    jsonPath
+}
+
+const requestBodyPrefix = "request.body"
+
+func parseRouteSelectionExpression(expr string) ([]routeSelectionPart, error) {
+	if expr == "" {
+		return nil, errors.New("empty expression")
+	}
+	if strings.HasPrefix(expr, "$request.") && !strings.Contains(expr, "${") {
+		path, err := parseRequestBodyPath(expr[1:])
+		if err != nil {
+			return nil, err
+		}
+		return []routeSelectionPart{{path: path}}, nil
+	}
+	var parts []routeSelectionPart
+	hasVariable := false
+	rest := expr
+	for rest != "" {
+		start := strings.Index(rest, "${")
+		if start < 0 {
+			parts = append(parts, routeSelectionPart{literal: rest})
+			break
+		}
+		if start > 0 {
+			parts = append(parts, routeSelectionPart{literal: rest[:start]})
+		}
+		end := strings.Index(rest[start:], "}")
+		if end < 0 {
+			return nil, errors.New("unterminated ${")
+		}
+		path, err := parseRequestBodyPath(rest[start+2 : start+end])
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, routeSelectionPart{path: path})
+		hasVariable = true
+		rest = rest[start+end+1:]
+	}
+	if !hasVariable {
+		return nil, errors.New("expression must contain $request.body reference")
+	}
+	return parts, nil
+}
+
+func parseRequestBodyPath(s string) (jsonPath, error) {
+	if !strings.HasPrefix(s, requestBodyPrefix) {
+		return nil, fmt.Errorf("unsupported variable %q, only request.body is supported", s)
+	}
+	s = s[len(requestBodyPrefix):]
+	if s == "" {
+		return nil, errors.New("request.body must be followed by JSON path")
+	}
+	var path jsonPath
+	for s != "" {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, errors.New("empty JSON path element")
+			}
+			path = append(path, jsonPathElement{key: s[:end]})
+			s = s[end:]
+		case '[':
+			end := strings.Index(s, "]")
+			if end < 0 {
+				return nil, errors.New("unterminated [")
+			}
+			index, err := strconv.Atoi(s[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid array index %q", s[1:end])
+			}
+			path = append(path, jsonPathElement{index: index, isIndex: true})
+			s = s[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected character %q in JSON path", s[0])
+		}
+	}
+	return path, nil
+}
+
+type jsonPathElement struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+type jsonPath []jsonPathElement
+
+func (p jsonPath) String() string {
+	var sb strings.Builder
+	sb.WriteString("$request.body")
+	for _, e := range p {
+		if e.isIndex {
+			fmt.Fprintf(&sb, "[%d]", e.index)
+		} else {
+			sb.WriteString(".")
+			sb.WriteString(e.key)
+		}
+	}
+	return sb.String()
+}
+
+func (p jsonPath) selectString(v interface{}) (string, error) {
+	for _, e := range p {
+		if e.isIndex {
+			a, ok := v.([]interface{})
+			if !ok || e.index >= len(a) {
+				return "", fmt.Errorf("%s is not found", p)
+			}
+			v = a[e.index]
+			continue
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("%s is not found", p)
+		}
+		if v, ok = m[e.key]; !ok {
+			return "", fmt.Errorf("%s is not found", p)
+		}
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("%s is not a scalar value", p)
+}
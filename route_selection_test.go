@@ -0,0 +1,70 @@
+package elevate_test
+
+import (
+	"testing"
+
+	"github.com/mashiike/elevate"
+)
+
+func TestRouteSelectionExpression(t *testing.T) {
+	cases := []struct {
+		expr    string
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{expr: "$request.body.action", body: `{"action":"hello"}`, want: "hello"},
+		{expr: "$request.body.action", body: `{"hoge":"fuga"}`, wantErr: true},
+		{expr: "$request.body.action", body: `not json`, wantErr: true},
+		{expr: "$request.body.message.type", body: `{"message":{"type":"chat"}}`, want: "chat"},
+		{expr: "$request.body.message.type", body: `{"message":"chat"}`, wantErr: true},
+		{expr: "$request.body.items[1].type", body: `{"items":[{"type":"a"},{"type":"b"}]}`, want: "b"},
+		{expr: "$request.body.items[2].type", body: `{"items":[{"type":"a"},{"type":"b"}]}`, wantErr: true},
+		{expr: "$request.body.version", body: `{"version":12}`, want: "12"},
+		{expr: "$request.body.enabled", body: `{"enabled":true}`, want: "true"},
+		{expr: "$request.body.message", body: `{"message":{"type":"chat"}}`, wantErr: true},
+		{expr: "${request.body.service}/${request.body.op}", body: `{"service":"room","op":"join"}`, want: "room/join"},
+		{expr: "v1:${request.body.op}", body: `{"op":"join"}`, want: "v1:join"},
+		{expr: "${request.body.service}/${request.body.op}", body: `{"service":"room"}`, wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.expr+" "+c.body, func(t *testing.T) {
+			selector, err := elevate.RouteSelectionExpression(c.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := selector([]byte(c.body))
+			if c.wantErr {
+				if err == nil {
+					t.Errorf("selector() = %s; want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.want {
+				t.Errorf("selector() = %s; want %s", got, c.want)
+			}
+		})
+	}
+}
+
+func TestRouteSelectionExpression__Invalid(t *testing.T) {
+	cases := []string{
+		"",
+		"action",
+		"$request.header.action",
+		"$request.body",
+		"$request.body..action",
+		"$request.body.items[x]",
+		"${request.body.action",
+	}
+	for _, expr := range cases {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := elevate.RouteSelectionExpression(expr); err == nil {
+				t.Errorf("RouteSelectionExpression(%q) succeeded; want error", expr)
+			}
+		})
+	}
+}
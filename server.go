@@ -7,14 +7,19 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
@@ -27,26 +32,36 @@ func generateID(size int) (string, error) {
 	return base64.URLEncoding.EncodeToString(randomBytes), nil
 }
 
-func writeCloseFrame(ws *websocket.Conn, code int, reason string) error {
-	return ws.WriteControl(
-		websocket.CloseMessage,
-		websocket.FormatCloseMessage(code, reason),
-		time.Now().Add(10*time.Second),
-	)
-}
-
 type WebsocketHTTPBridgeHandler struct {
-	Handler                http.Handler
-	callbackURL            string
-	routeKeySelector       RouteKeySelector
-	mu                     sync.RWMutex
-	logger                 *slog.Logger
-	connections            map[string]*websocket.Conn
-	connectionReq          map[string]*http.Request
-	connectionConnectedAt  map[string]time.Time
-	connectionLastActiveAt map[string]time.Time
-	router                 *http.ServeMux
-	verbose                bool
+	Handler                  http.Handler
+	callbackURL              string
+	routeKeySelector         RouteKeySelector
+	mu                       sync.RWMutex
+	logger                   *slog.Logger
+	connections              map[string]*connWriter
+	connectionReq            map[string]*http.Request
+	connectionConnectedAt    map[string]time.Time
+	connectionLastActiveAt   map[string]time.Time
+	connectionAuthorizer     map[string]interface{}
+	connectionDisconnect     map[string]DisconnectStatus
+	serving                  map[string]*servingConn
+	stages                   map[string]map[string]string
+	shuttingDown             bool
+	authorizer               Authorizer
+	routeResponses           map[string]bool
+	defaultRouteResponse     bool
+	mgmtClient               ManagementAPIClient
+	outboundQueueSize        int
+	writeTimeout             time.Duration
+	idleTimeout              time.Duration
+	maxConnectionDuration    time.Duration
+	pingInterval             time.Duration
+	maxMessageSize           int64
+	connectionsAPIPrincipals []ConnectionsAPIPrincipal
+	recorder                 *sessionRecorder
+	lambdaHandler            lambda.Handler
+	router                   *http.ServeMux
+	verbose                  bool
 	websocket.Upgrader
 }
 
@@ -56,10 +71,21 @@ func NewWebsocketHTTPBridgeHandler(handler http.Handler) *WebsocketHTTPBridgeHan
 		routeKeySelector:       DefaultRouteKeySelector,
 		callbackURL:            "http://localhost",
 		logger:                 slog.Default(),
-		connections:            make(map[string]*websocket.Conn),
+		connections:            make(map[string]*connWriter),
 		connectionReq:          make(map[string]*http.Request),
 		connectionConnectedAt:  make(map[string]time.Time),
 		connectionLastActiveAt: make(map[string]time.Time),
+		connectionAuthorizer:   make(map[string]interface{}),
+		connectionDisconnect:   make(map[string]DisconnectStatus),
+		serving:                make(map[string]*servingConn),
+		stages:                 make(map[string]map[string]string),
+		routeResponses:         make(map[string]bool),
+		defaultRouteResponse:   true,
+		outboundQueueSize:      DefaultOutboundQueueSize,
+		writeTimeout:           DefaultWriteTimeout,
+		idleTimeout:            DefaultIdleTimeout,
+		maxConnectionDuration:  DefaultMaxConnectionDuration,
+		maxMessageSize:         DefaultMaxMessageSize,
 		router:                 http.NewServeMux(),
 		Upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
@@ -93,56 +119,313 @@ func (h *WebsocketHTTPBridgeHandler) SetRouteKeySelector(selector RouteKeySelect
 	h.routeKeySelector = selector
 }
 
+// SetAuthorizer sets Authorizer for $connect route, it emulates Lambda REQUEST authorizer.
+func (h *WebsocketHTTPBridgeHandler) SetAuthorizer(authorizer Authorizer) {
+	h.authorizer = authorizer
+}
+
+// SetRouteResponse sets whether the integration response of the route is returned to the client.
+// same as route response is configured for the route on API Gateway.
+// the route key is the selected route key of the message, $default route is configured by "$default".
+func (h *WebsocketHTTPBridgeHandler) SetRouteResponse(routeKey string, enabled bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.routeResponses[routeKey] = enabled
+}
+
+// SetDefaultRouteResponse sets whether the integration response is returned for routes not configured by SetRouteResponse.
+// default is true for compatibility. API Gateway does not return the integration response without route response, set false to emulate it.
+func (h *WebsocketHTTPBridgeHandler) SetDefaultRouteResponse(enabled bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.defaultRouteResponse = enabled
+}
+
+// SetManagementAPIClient sets ManagementAPIClient used by handler, default is the client for this bridge.
+func (h *WebsocketHTTPBridgeHandler) SetManagementAPIClient(client ManagementAPIClient) {
+	h.mgmtClient = client
+}
+
+// SetRecorder sets the writer to record every event and response of the handler as JSONL of Record.
+// the recording can be replayed by Replay as regression test. nil disables recording.
+func (h *WebsocketHTTPBridgeHandler) SetRecorder(w io.Writer) {
+	if w == nil {
+		h.recorder = nil
+		return
+	}
+	h.recorder = &sessionRecorder{enc: json.NewEncoder(w)}
+}
+
+// SetLambdaHandler sets lambda.Handler to invoke instead of Handler, events are sent as the payload of Lambda invocation.
+// for example NewLambdaHandler or NewRuntimeInterfaceEmulatorHandler, to test Lambda code path locally. nil disables it.
+func (h *WebsocketHTTPBridgeHandler) SetLambdaHandler(handler lambda.Handler) {
+	h.lambdaHandler = handler
+}
+
+// SetOutboundQueueSize sets the number of outbound messages buffered per connection.
+// all writes to the connection (integration responses, @connections posts and control frames) are serialized through the queue.
+func (h *WebsocketHTTPBridgeHandler) SetOutboundQueueSize(size int) {
+	h.outboundQueueSize = size
+}
+
+// SetWriteTimeout sets the timeout to write a message to the connection.
+// if the outbound queue is full longer than the timeout, @connections POST fails with LimitExceededException.
+func (h *WebsocketHTTPBridgeHandler) SetWriteTimeout(timeout time.Duration) {
+	h.writeTimeout = timeout
+}
+
+// SetIdleTimeout sets the idle timeout of the connection, default is 10 minutes same as API Gateway.
+// when no message is received from the client within the timeout, the connection is closed with 1001 Going Away and $disconnect is fired.
+// zero means no idle timeout.
+func (h *WebsocketHTTPBridgeHandler) SetIdleTimeout(timeout time.Duration) {
+	h.idleTimeout = timeout
+}
+
+// SetMaxConnectionDuration sets the maximum duration of the connection, default is 2 hours same as API Gateway.
+// when the duration is exceeded, the connection is closed with 1001 Going Away and $disconnect is fired.
+// zero means no limit.
+func (h *WebsocketHTTPBridgeHandler) SetMaxConnectionDuration(duration time.Duration) {
+	h.maxConnectionDuration = duration
+}
+
+// SetPingInterval sets the interval to send ping frame to the client, default is zero (disabled).
+// ping and pong frames do not reset the idle timeout.
+func (h *WebsocketHTTPBridgeHandler) SetPingInterval(interval time.Duration) {
+	h.pingInterval = interval
+}
+
+// SetMaxMessageSize sets the maximum size of inbound message and @connections POST payload, default is 128 KB same as API Gateway.
+// oversize inbound message closes the connection with 1009 Message Too Big, oversize POST responds 413 PayloadTooLargeException.
+// zero or negative means no limit.
+// note: 32 KB frame limit of API Gateway is not enforced, frames are not visible from gorilla/websocket.
+func (h *WebsocketHTTPBridgeHandler) SetMaxMessageSize(size int64) {
+	h.maxMessageSize = size
+}
+
+// SetConnectionsAPIPrincipals sets principals allowed to call @connections API.
+// if set, @connections API verifies SigV4 signature and permission of execute-api:ManageConnections,
+// and responds 403 ForbiddenException same as AWS. default is no verification.
+// the credential scope should be the local region (AWS_REGION or us-east-1) and execute-api.
+// the handler calls @connections API with LocalCredentials, add the principal of LocalCredentials to allow them.
+func (h *WebsocketHTTPBridgeHandler) SetConnectionsAPIPrincipals(principals ...ConnectionsAPIPrincipal) {
+	h.connectionsAPIPrincipals = principals
+}
+
+// SetAllowedOrigins sets allowed origins of websocket upgrade, default allows same origin only.
+// origin can contain wildcard `*` and `?`, for example `http://localhost:*`. `*` allows all origins.
+func (h *WebsocketHTTPBridgeHandler) SetAllowedOrigins(origins ...string) {
+	patterns := make([]string, 0, len(origins))
+	for _, origin := range origins {
+		patterns = append(patterns, strings.ToLower(origin))
+	}
+	h.CheckOrigin = func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		return matchAny(patterns, strings.ToLower(origin))
+	}
+}
+
+// SetCheckOrigin sets the function to check origin of websocket upgrade, same as websocket.Upgrader.CheckOrigin.
+func (h *WebsocketHTTPBridgeHandler) SetCheckOrigin(checkOrigin func(r *http.Request) bool) {
+	h.CheckOrigin = checkOrigin
+}
+
+func (h *WebsocketHTTPBridgeHandler) checkOrigin(r *http.Request) bool {
+	if h.CheckOrigin != nil {
+		return h.CheckOrigin(r)
+	}
+	// same as default of websocket.Upgrader
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// SetStage adds the stage served under the path prefix `/{stage}` with stage variables, same as API Gateway stage.
+// websocket URL is `ws://{host}/{stage}` and @connections API is `/{stage}/@connections/{connectionId}`.
+// if no stage is set, the bridge serves `/` without stage.
+func (h *WebsocketHTTPBridgeHandler) SetStage(stage string, stageVariables map[string]string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	vars := make(map[string]string, len(stageVariables))
+	for k, v := range stageVariables {
+		vars[k] = v
+	}
+	h.stages[stage] = vars
+}
+
+// stageFromPath returns the stage of the path, ok is false if stages are set and the path is not under any stage.
+func (h *WebsocketHTTPBridgeHandler) stageFromPath(path string) (string, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if len(h.stages) == 0 {
+		return "", true
+	}
+	stage, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if _, ok := h.stages[stage]; ok {
+		return stage, true
+	}
+	return "", false
+}
+
+func (h *WebsocketHTTPBridgeHandler) stageVariables(stage string) map[string]string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	vars, ok := h.stages[stage]
+	if !ok {
+		return nil
+	}
+	copied := make(map[string]string, len(vars))
+	for k, v := range vars {
+		copied[k] = v
+	}
+	return copied
+}
+
+func (h *WebsocketHTTPBridgeHandler) hasRouteResponse(routeKey string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if enabled, ok := h.routeResponses[routeKey]; ok {
+		return enabled
+	}
+	return h.defaultRouteResponse
+}
+
 func (h *WebsocketHTTPBridgeHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	h.debugVerbose("receive request", "method", req.Method, "path", req.URL.Path)
+	if stage, ok := h.stageFromPath(req.URL.Path); ok && stage != "" && strings.HasPrefix(req.URL.Path, "/"+stage+"/@connections/") {
+		h.serveConnections(w, req)
+		return
+	}
 	h.router.ServeHTTP(w, req)
 }
 
 func (h *WebsocketHTTPBridgeHandler) serveWebsocket(w http.ResponseWriter, req *http.Request) {
 	h.debugVerbose("start serve websocket", "method", req.Method, "path", req.URL.Path)
-	connectionID, conn, err := h.onConnect(w, req)
+	if h.isShuttingDown() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if _, ok := h.stageFromPath(req.URL.Path); !ok {
+		h.logger.WarnContext(req.Context(), "stage not found", "path", req.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	connectionID, cw, err := h.onConnect(w, req)
 	if err != nil {
 		h.logger.ErrorContext(req.Context(), "failed to connect", "detail", err)
 		return
 	}
+	defer h.untrackServing(connectionID)
+	conn := cw.ws
 	defer conn.Close()
+	defer cw.close()
 	defer h.onDisonnect(connectionID)
+	if h.isShuttingDown() {
+		// connected while shutting down, Shutdown does not know this connection.
+		h.removeFromConnectionList(connectionID, websocket.CloseGoingAway, "Going away")
+		return
+	}
+	conn.SetPingHandler(cw.handlePing)
+	if h.maxMessageSize > 0 {
+		// gorilla/websocket writes close frame 1009 when exceeded.
+		conn.SetReadLimit(h.maxMessageSize)
+	}
+	if h.pingInterval > 0 {
+		go cw.keepalive(h.pingInterval)
+	}
+	connectedAt, _, _ := h.getConnectionInfo(connectionID)
+	lastActiveAt := connectedAt
 	for {
-		if err := conn.SetReadDeadline(time.Now().Add(10 * time.Minute)); err != nil {
+		deadline, isIdle := h.readDeadline(connectedAt, lastActiveAt)
+		if err := conn.SetReadDeadline(deadline); err != nil {
 			h.logger.ErrorContext(req.Context(), "failed to set read deadline", "detail", err)
 			h.removeFromConnectionList(connectionID, websocket.CloseInternalServerErr, "Cannot Set Read Deadline")
 			return
 		}
-		_, msg, err := conn.ReadMessage()
+		messageType, msg, err := conn.ReadMessage()
 		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				if isIdle {
+					h.debugVerbose("idle timeout", "connection_id", connectionID, "idle_timeout", h.idleTimeout)
+				} else {
+					h.debugVerbose("maximum connection duration exceeded", "connection_id", connectionID, "max_connection_duration", h.maxConnectionDuration)
+				}
+				h.removeFromConnectionList(connectionID, websocket.CloseGoingAway, "Going away")
+				return
+			}
+
+			if errors.Is(err, websocket.ErrReadLimit) {
+				h.logger.Warn("message too big", "connection_id", connectionID, "max_message_size", h.maxMessageSize)
+				h.setDisconnectReason(connectionID, websocket.CloseMessageTooBig, "Message too big")
+				h.removeFromConnectionList(connectionID, 0, "")
+				return
+			}
 
 			if errors.Is(err, io.EOF) {
 				h.debugVerbose("receive EOF")
+				h.setDisconnectReason(connectionID, websocket.CloseAbnormalClosure, "")
 				h.removeFromConnectionList(connectionID, 0, "")
 			}
 
 			var closeErr *websocket.CloseError
 			if errors.As(err, &closeErr) {
-				h.removeFromConnectionList(connectionID, 0, "")
+				h.setDisconnectReason(connectionID, closeErr.Code, closeErr.Text)
+				removed := h.removeFromConnectionList(connectionID, 0, "")
 				h.debugVerbose("receive close frame", "code", closeErr.Code, "reason", closeErr.Text)
-				if closeErr.Code == websocket.CloseNormalClosure {
+				if !removed || closeErr.Code == websocket.CloseNormalClosure {
+					// already closed by server, or closed normally by client
 					return
 				}
 				h.logger.Warn("receive close frame", "code", closeErr.Code, "reason", closeErr.Text, "connection_id", connectionID)
 			}
+			if cw.isBroken() {
+				h.debugVerbose("connection is closed by write timeout", "connection_id", connectionID)
+				h.setDisconnectReason(connectionID, websocket.CloseAbnormalClosure, "")
+				h.removeFromConnectionList(connectionID, 0, "")
+				return
+			}
 			h.logger.ErrorContext(req.Context(), "failed to receive message", "detail", err)
 			h.removeFromConnectionList(connectionID, websocket.CloseInternalServerErr, "Cannot Receive Message")
 			return
 		}
-		if err := h.onReceiveMessage(connectionID, conn, msg); err != nil {
+		lastActiveAt = time.Now()
+		if err := h.onReceiveMessage(connectionID, cw, messageType, msg); err != nil {
 			h.logger.ErrorContext(req.Context(), "failed to receive message", "detail", err)
 			return
 		}
 	}
 }
 
+// readDeadline returns the read deadline of the connection and whether it is caused by idle timeout.
+func (h *WebsocketHTTPBridgeHandler) readDeadline(connectedAt, lastActiveAt time.Time) (time.Time, bool) {
+	var deadline time.Time
+	isIdle := false
+	if h.idleTimeout > 0 {
+		deadline = lastActiveAt.Add(h.idleTimeout)
+		isIdle = true
+	}
+	if h.maxConnectionDuration > 0 {
+		maxDeadline := connectedAt.Add(h.maxConnectionDuration)
+		if deadline.IsZero() || maxDeadline.Before(deadline) {
+			deadline = maxDeadline
+			isIdle = false
+		}
+	}
+	return deadline, isIdle
+}
+
 func (h *WebsocketHTTPBridgeHandler) serveConnections(w http.ResponseWriter, req *http.Request) {
-	cid := req.URL.Path[len("/@connections/"):]
+	prefix, cid, _ := strings.Cut(req.URL.Path, "/@connections/")
+	stage := strings.TrimPrefix(prefix, "/")
 	uuidObj, err := uuid.NewRandom()
 	if err != nil {
 		h.logger.Error("@connections failed to generate uuid", "detail", err)
@@ -156,7 +439,34 @@ func (h *WebsocketHTTPBridgeHandler) serveConnections(w http.ResponseWriter, req
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("X-Amzn-RequestId", uuidObj.String())
-	conn, ok := h.getConn(cid)
+	if len(h.connectionsAPIPrincipals) > 0 {
+		if err := h.verifyConnectionsRequest(req, stage, cid); err != nil {
+			if errors.Is(err, errConnectionsPayloadTooLarge) {
+				logger.Warn("@connections payload too large", "max_message_size", h.maxMessageSize)
+				w.Header().Set("X-Amzn-ErrorType", "PayloadTooLargeException")
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+			logger.Warn("@connections forbidden", "detail", err)
+			w.Header().Set("X-Amzn-ErrorType", "ForbiddenException")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+	}
+	if s, ok := h.stageFromPath(req.URL.Path); !ok || s != stage {
+		w.Header().Set("X-Amzn-ErrorType", "NotFoundException")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	cw, ok := h.getConn(cid)
+	if ok {
+		// the connection of other stage is not visible.
+		_, _, originReq := h.getConnectionInfo(cid)
+		if originReq != nil {
+			connStage, _ := h.stageFromPath(originReq.URL.Path)
+			ok = connStage == stage
+		}
+	}
 	if !ok {
 		w.Header().Set("X-Amzn-ErrorType", "GoneException")
 		w.WriteHeader(http.StatusGone)
@@ -165,20 +475,46 @@ func (h *WebsocketHTTPBridgeHandler) serveConnections(w http.ResponseWriter, req
 	defer req.Body.Close()
 	switch req.Method {
 	case http.MethodPost:
-		bs, err := io.ReadAll(req.Body)
+		var body io.Reader = req.Body
+		if h.maxMessageSize > 0 {
+			body = io.LimitReader(req.Body, h.maxMessageSize+1)
+		}
+		bs, err := io.ReadAll(body)
 		if err != nil {
 			logger.Error("@connections failed to read body", "detail", err)
 			w.Header().Set("X-Amzn-ErrorType", "InternalServerError")
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		if h.maxMessageSize > 0 && int64(len(bs)) > h.maxMessageSize {
+			logger.Warn("@connections payload too large", "max_message_size", h.maxMessageSize)
+			w.Header().Set("X-Amzn-ErrorType", "PayloadTooLargeException")
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
 		var messageType int
 		if isBinary(req.Header) {
 			messageType = websocket.BinaryMessage
 		} else {
 			messageType = websocket.TextMessage
 		}
-		if err := conn.WriteMessage(messageType, bs); err != nil {
+		if err := cw.write(req.Context(), messageType, bs); err != nil {
+			if errors.Is(err, errOutboundQueueFull) {
+				logger.Warn("@connections outbound queue is full", "detail", err)
+				if cw.isBroken() {
+					// later calls are responded GoneException, same as closed connection.
+					h.setDisconnectReason(cid, websocket.CloseAbnormalClosure, "")
+					h.removeFromConnectionList(cid, 0, "")
+				}
+				w.Header().Set("X-Amzn-ErrorType", "LimitExceededException")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			if errors.Is(err, errConnWriterClosed) {
+				w.Header().Set("X-Amzn-ErrorType", "GoneException")
+				w.WriteHeader(http.StatusGone)
+				return
+			}
 			logger.Error("@connections failed to send message", "detail", err)
 			w.Header().Set("X-Amzn-ErrorType", "InternalServerError")
 			w.WriteHeader(http.StatusInternalServerError)
@@ -222,68 +558,266 @@ func (h *WebsocketHTTPBridgeHandler) serveConnections(w http.ResponseWriter, req
 	w.WriteHeader(http.StatusNotFound)
 }
 
-func (h *WebsocketHTTPBridgeHandler) newBridgeRequest(
-	ctx context.Context,
+// disconnectHeaders are headers of $disconnect event sent by API Gateway with empty value, in addition to Host.
+var disconnectHeaders = []string{"x-api-key", "X-Forwarded-For", "x-restapi"}
+
+// requestTimeFormat is a format of requestContext.requestTime, same as API Gateway.
+const requestTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// newProxyRequest creates synthetic API Gateway Websocket API Proxy Request, same shape as Lambda receives.
+func (h *WebsocketHTTPBridgeHandler) newProxyRequest(
 	connectionID string,
-	host string,
+	connectedAt time.Time,
 	eventType string,
 	routeKey string,
-	body io.Reader,
-) (*http.Request, error) {
+	originReq *http.Request,
+) (*events.APIGatewayWebsocketProxyRequest, error) {
 	requestID, err := generateID(11)
 	if err != nil {
 		return nil, err
 	}
-	u := url.URL{
-		Scheme: "ws",
-		Host:   host,
-		Path:   routeKey,
+	now := time.Now()
+	proxyReq := &events.APIGatewayWebsocketProxyRequest{
+		RequestContext: events.APIGatewayWebsocketProxyRequestContext{
+			ConnectionID:      connectionID,
+			RequestID:         requestID,
+			ExtendedRequestID: requestID,
+			EventType:         eventType,
+			RouteKey:          routeKey,
+			DomainName:        originReq.Host,
+			Identity: events.APIGatewayRequestIdentity{
+				SourceIP:  sourceIP(originReq),
+				UserAgent: originReq.UserAgent(),
+			},
+			Authorizer:       h.getConnectionAuthorizer(connectionID),
+			ConnectedAt:      connectedAt.UnixMilli(),
+			RequestTime:      now.Format(requestTimeFormat),
+			RequestTimeEpoch: now.UnixMilli(),
+			MessageDirection: "IN",
+		},
 	}
-	if body == nil {
-		body = bytes.NewReader([]byte{})
+	if originReq.URL != nil {
+		stage, _ := h.stageFromPath(originReq.URL.Path)
+		proxyReq.RequestContext.Stage = stage
+		proxyReq.StageVariables = h.stageVariables(stage)
 	}
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodGet,
-		u.String(),
-		body,
-	)
-	if err != nil {
-		return nil, err
+	switch eventType {
+	case "CONNECT":
+	case "DISCONNECT":
+		// same as API Gateway, headers of $disconnect are fixed and empty except Host.
+		proxyReq.Headers = make(map[string]string, len(disconnectHeaders)+1)
+		proxyReq.MultiValueHeaders = make(map[string][]string, len(disconnectHeaders)+1)
+		proxyReq.Headers["Host"] = originReq.Host
+		proxyReq.MultiValueHeaders["Host"] = []string{originReq.Host}
+		for _, k := range disconnectHeaders {
+			proxyReq.Headers[k] = ""
+			proxyReq.MultiValueHeaders[k] = []string{""}
+		}
+		return proxyReq, nil
+	default:
+		return proxyReq, nil
+	}
+	proxyReq.Headers = map[string]string{
+		"Host": originReq.Host,
+	}
+	proxyReq.MultiValueHeaders = map[string][]string{
+		"Host": {originReq.Host},
 	}
-	req.Header.Set(HTTPHeaderConnectionID, connectionID)
-	req.Header.Set(HTTPHeaderRequestID, requestID)
-	req.Header.Set(HTTPHeaderEventType, eventType)
-	req.Header.Set(HTTPHeaderRouteKey, routeKey)
-	return req, nil
+	for k, v := range originReq.Header {
+		if len(v) == 0 {
+			continue
+		}
+		proxyReq.Headers[k] = v[len(v)-1]
+		proxyReq.MultiValueHeaders[k] = append([]string(nil), v...)
+	}
+	if query := originReq.URL.Query(); len(query) > 0 {
+		proxyReq.QueryStringParameters = make(map[string]string, len(query))
+		proxyReq.MultiValueQueryStringParameters = make(map[string][]string, len(query))
+		for k, v := range query {
+			if len(v) == 0 {
+				continue
+			}
+			proxyReq.QueryStringParameters[k] = v[len(v)-1]
+			proxyReq.MultiValueQueryStringParameters[k] = v
+		}
+	}
+	return proxyReq, nil
 }
 
-func (h *WebsocketHTTPBridgeHandler) addToConnectionList(connectionID string, connectedAt time.Time, req *http.Request, ws *websocket.Conn) {
+// invoke calls the handler with the proxy request, same as Lambda function invoked by API Gateway.
+func (h *WebsocketHTTPBridgeHandler) invoke(ctx context.Context, proxyReq *events.APIGatewayWebsocketProxyRequest) (*ResponseWriter, error) {
+	callbackURL := h.callbackURL
+	if stage := proxyReq.RequestContext.Stage; stage != "" {
+		callbackURL = strings.TrimSuffix(callbackURL, "/") + "/" + stage
+	}
+	ctx = ContextWithCallbackURL(ctx, callbackURL)
+	if h.mgmtClient != nil {
+		ctx = ContextWithManagementAPIClient(ctx, h.mgmtClient)
+	}
+	var respWriter *ResponseWriter
+	if h.lambdaHandler != nil {
+		var err error
+		respWriter, err = h.invokeLambda(ctx, proxyReq)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		req, err := newRequestFromProxyRequest(ctx, proxyReq)
+		if err != nil {
+			return nil, err
+		}
+		respWriter = NewResponseWriter()
+		h.Handler.ServeHTTP(respWriter, req)
+	}
+	if h.recorder != nil {
+		if err := h.recorder.record(ctx, proxyReq, respWriter.Response()); err != nil {
+			h.logger.Error("failed to record event", "detail", err, "connection_id", proxyReq.RequestContext.ConnectionID)
+		}
+	}
+	return respWriter, nil
+}
+
+func (h *WebsocketHTTPBridgeHandler) addToConnectionList(connectionID string, connectedAt time.Time, req *http.Request, cw *connWriter, authorizer interface{}) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	h.connections[connectionID] = ws
+	h.connections[connectionID] = cw
+	h.serving[connectionID] = &servingConn{cw: cw, done: make(chan struct{})}
 	h.connectionReq[connectionID] = req.Clone(context.TODO())
 	h.connectionConnectedAt[connectionID] = connectedAt
 	h.connectionLastActiveAt[connectionID] = connectedAt
+	if authorizer != nil {
+		h.connectionAuthorizer[connectionID] = authorizer
+	}
 }
 
 func (h *WebsocketHTTPBridgeHandler) removeFromConnectionList(connectionID string, code int, reason string) bool {
 	h.mu.Lock()
-	defer h.mu.Unlock()
-	conn, ok := h.connections[connectionID]
+	cw, ok := h.connections[connectionID]
 	if !ok {
+		h.mu.Unlock()
 		return false
 	}
 	delete(h.connections, connectionID)
+	if _, ok := h.connectionDisconnect[connectionID]; !ok && code > 0 {
+		h.connectionDisconnect[connectionID] = DisconnectStatus{StatusCode: code, Reason: reason}
+	}
+	h.mu.Unlock()
 	if code > 0 {
-		if err := writeCloseFrame(conn, code, reason); err != nil {
+		if err := cw.writeClose(code, reason); err != nil {
 			h.logger.Error("failed to write close frame", "detail", err, "connection_id", connectionID)
 		}
 	}
 	return true
 }
 
-func (h *WebsocketHTTPBridgeHandler) getConn(connectionID string) (*websocket.Conn, bool) {
+// untrackServing marks that serving the connection is finished, it is called after $disconnect.
+func (h *WebsocketHTTPBridgeHandler) untrackServing(connectionID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if sc, ok := h.serving[connectionID]; ok {
+		close(sc.done)
+		delete(h.serving, connectionID)
+	}
+}
+
+// servingConn is a connection served by serveWebsocket, done is closed after $disconnect.
+type servingConn struct {
+	cw   *connWriter
+	done chan struct{}
+}
+
+func (h *WebsocketHTTPBridgeHandler) isShuttingDown() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.shuttingDown
+}
+
+// ShutdownError is returned by Shutdown when some connections are not drained before the context is done.
+type ShutdownError struct {
+	// ConnectionIDs is a list of connection ids that $disconnect handler is not finished.
+	ConnectionIDs []string
+	Err           error
+}
+
+func (e *ShutdownError) Error() string {
+	return fmt.Sprintf("elevate: %d connections are not drained: %s: %v", len(e.ConnectionIDs), strings.Join(e.ConnectionIDs, ", "), e.Err)
+}
+
+func (e *ShutdownError) Unwrap() error {
+	return e.Err
+}
+
+// Shutdown gracefully closes all connections, same as API Gateway on deployment.
+//
+// it rejects new connections, sends close frame 1001 Going Away to each connection,
+// and waits for $disconnect handler of each connection until the context is done.
+// if the context is done before all connections are drained, remaining connections are closed forcibly
+// and *ShutdownError that reports them is returned.
+// Shutdown does not stop @connections API, call it before http.Server.Shutdown to allow $disconnect handler to post to other connections.
+func (h *WebsocketHTTPBridgeHandler) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	h.shuttingDown = true
+	serving := make(map[string]*servingConn, len(h.serving))
+	for id, sc := range h.serving {
+		serving[id] = sc
+	}
+	h.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for id := range serving {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			h.removeFromConnectionList(id, websocket.CloseGoingAway, "Going away")
+		}(id)
+	}
+	wg.Wait()
+
+	var undrained []string
+	for id, sc := range serving {
+		select {
+		case <-sc.done:
+			continue
+		case <-ctx.Done():
+		}
+		select {
+		case <-sc.done:
+		default:
+			undrained = append(undrained, id)
+			// unblock read loop, $disconnect is fired in background.
+			sc.cw.ws.Close()
+		}
+	}
+	if len(undrained) == 0 {
+		return nil
+	}
+	sort.Strings(undrained)
+	return &ShutdownError{ConnectionIDs: undrained, Err: ctx.Err()}
+}
+
+// setDisconnectReason records the close status of client-initiated close, first one wins.
+func (h *WebsocketHTTPBridgeHandler) setDisconnectReason(connectionID string, code int, reason string) {
+	if code == websocket.CloseNoStatusReceived && reason == "" {
+		// same as API Gateway
+		reason = "Client-side close frame status not set"
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.connectionDisconnect[connectionID]; ok {
+		return
+	}
+	h.connectionDisconnect[connectionID] = DisconnectStatus{StatusCode: code, Reason: reason}
+}
+
+func (h *WebsocketHTTPBridgeHandler) popDisconnectReason(connectionID string) DisconnectStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	reason := h.connectionDisconnect[connectionID]
+	delete(h.connectionDisconnect, connectionID)
+	return reason
+}
+
+func (h *WebsocketHTTPBridgeHandler) getConn(connectionID string) (*connWriter, bool) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 	conn, ok := h.connections[connectionID]
@@ -300,6 +834,7 @@ func (h *WebsocketHTTPBridgeHandler) popConnectionInfo(connectionID string) (tim
 		delete(h.connectionConnectedAt, connectionID)
 		delete(h.connectionLastActiveAt, connectionID)
 		delete(h.connectionReq, connectionID)
+		delete(h.connectionAuthorizer, connectionID)
 	}
 	return connectedAt, lastActiveAt, req
 }
@@ -313,16 +848,22 @@ func (h *WebsocketHTTPBridgeHandler) getConnectionInfo(connectionID string) (tim
 	return connectedAt, lastActiveAt, req
 }
 
+func (h *WebsocketHTTPBridgeHandler) getConnectionAuthorizer(connectionID string) interface{} {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.connectionAuthorizer[connectionID]
+}
+
 func (h *WebsocketHTTPBridgeHandler) markActiveAt(connectionID string) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	h.connectionLastActiveAt[connectionID] = time.Now()
 }
 
-func (h *WebsocketHTTPBridgeHandler) getConnections() map[string]*websocket.Conn {
+func (h *WebsocketHTTPBridgeHandler) getConnections() map[string]*connWriter {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	connections := make(map[string]*websocket.Conn)
+	connections := make(map[string]*connWriter)
 	for k, v := range h.connections {
 		connections[k] = v
 	}
@@ -335,7 +876,7 @@ func (h *WebsocketHTTPBridgeHandler) currentConnections() int {
 	return len(h.connections)
 }
 
-func (h *WebsocketHTTPBridgeHandler) onConnect(w http.ResponseWriter, originReq *http.Request) (string, *websocket.Conn, error) {
+func (h *WebsocketHTTPBridgeHandler) onConnect(w http.ResponseWriter, originReq *http.Request) (string, *connWriter, error) {
 	now := time.Now()
 	connectionID, err := generateID(11)
 	if err != nil {
@@ -343,68 +884,65 @@ func (h *WebsocketHTTPBridgeHandler) onConnect(w http.ResponseWriter, originReq
 		return "", nil, err
 	}
 	h.debugVerbose("generate connection id", "connection_id", connectionID, "remote_addr", originReq.RemoteAddr)
-	req, err := h.newBridgeRequest(
-		originReq.Context(),
-		connectionID,
-		originReq.Host,
-		"CONNECT",
-		"$connect",
-		bytes.NewReader([]byte{}),
-	)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return "", nil, err
+	if !h.checkOrigin(originReq) {
+		h.logger.WarnContext(originReq.Context(), "reject upgrade, origin is not allowed",
+			"origin", originReq.Header.Get("Origin"),
+			"host", originReq.Host,
+			"remote_addr", originReq.RemoteAddr,
+		)
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(http.StatusText(http.StatusForbidden)))
+		return "", nil, errors.New("origin is not allowed")
 	}
-	requsetID, err := generateID(11)
+	proxyReq, err := h.newProxyRequest(connectionID, now, "CONNECT", "$connect", originReq)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return "", nil, err
 	}
-	for k, v := range originReq.Header {
-		for _, vv := range v {
-			req.Header.Add(k, vv)
-		}
-	}
-	req.Header.Set(HTTPHeaderConnectionID, connectionID)
-	req.Header.Set(HTTPHeaderRequestID, requsetID)
-	req.Header.Set(HTTPHeaderEventType, "CONNECT")
-	req.Header.Set(HTTPHeaderRouteKey, "$connect")
-	proxyCtx := events.APIGatewayWebsocketProxyRequestContext{
-		ConnectionID:      connectionID,
-		RequestID:         requsetID,
-		ExtendedRequestID: requsetID,
-		EventType:         "CONNECT",
-		RouteKey:          "$connect",
-		DomainName:        originReq.Host,
-		Identity: events.APIGatewayRequestIdentity{
-			SourceIP: originReq.RemoteAddr,
-		},
-		ConnectedAt:      int64(now.UnixNano() / int64(time.Millisecond)),
-		RequestTime:      now.Format(time.Layout),
-		RequestTimeEpoch: int64(now.UnixNano() / int64(time.Millisecond)),
-		MessageDirection: "IN",
+	if h.authorizer != nil {
+		authCtx, status, err := h.authorize(originReq, proxyReq.RequestContext)
+		if err != nil {
+			h.debugVerbose("authorizer denied", "status", status, "detail", err, "connection_id", connectionID)
+			w.WriteHeader(status)
+			w.Write([]byte(http.StatusText(status)))
+			return "", nil, err
+		}
+		proxyReq.RequestContext.Authorizer = authCtx
 	}
-	ctx := contextWithRequestContext(req.Context(), proxyCtx)
-	req = req.WithContext(ctx)
 	h.debugVerbose("prepare connect bridge request", "connection_id", connectionID, "remote_addr", originReq.RemoteAddr)
 
-	respWriter := NewResponseWriter()
-	h.Handler.ServeHTTP(respWriter, req)
-
+	respWriter, err := h.invoke(originReq.Context(), proxyReq)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return "", nil, err
+	}
 	if respWriter.statusCode != http.StatusOK {
 		h.debugVerbose("failed bridge handler", "status", respWriter.statusCode)
+		for k, v := range respWriter.Header() {
+			w.Header()[k] = v
+		}
 		w.WriteHeader(respWriter.statusCode)
 
 		return "", nil, errors.New("failed bridge handler")
 	}
-	conn, err := h.Upgrade(w, originReq, nil)
+	responseHeader, err := upgradeResponseHeader(respWriter.Header(), originReq)
+	if err != nil {
+		h.logger.WarnContext(originReq.Context(), "reject upgrade", "detail", err, "connection_id", connectionID)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(http.StatusText(http.StatusBadRequest)))
+		// $connect handler has accepted the connection, $disconnect handler should clean up it.
+		h.invokeDisconnect(connectionID, now, originReq, proxyReq.RequestContext.Authorizer, DisconnectStatus{StatusCode: websocket.CloseAbnormalClosure})
+		return "", nil, err
+	}
+	conn, err := h.Upgrade(w, originReq, responseHeader)
 	if err != nil {
-		h.logger.ErrorContext(req.Context(), "failed to upgrade", "detail", err)
+		h.logger.ErrorContext(originReq.Context(), "failed to upgrade", "detail", err)
 		w.WriteHeader(http.StatusInternalServerError)
-
+		h.invokeDisconnect(connectionID, now, originReq, proxyReq.RequestContext.Authorizer, DisconnectStatus{StatusCode: websocket.CloseAbnormalClosure})
 		return "", nil, err
 	}
-	h.addToConnectionList(connectionID, now, originReq, conn)
+	cw := newConnWriter(conn, h.outboundQueueSize, h.writeTimeout)
+	h.addToConnectionList(connectionID, now, originReq, cw, proxyReq.RequestContext.Authorizer)
 	h.debugVerbose("connected", "connection_id", connectionID)
 	if h.verbose {
 		h.logger.Info("connected",
@@ -414,15 +952,38 @@ func (h *WebsocketHTTPBridgeHandler) onConnect(w http.ResponseWriter, originReq
 			"current_connections", h.currentConnections(),
 		)
 	}
-	return connectionID, conn, err
+	return connectionID, cw, err
+}
+
+// upgradeResponseHeader returns headers of $connect handler response to be copied into the upgrade response.
+//
+// Sec-WebSocket-Protocol is negotiated same as API Gateway, the handler must select one of the protocols offered by the client.
+func upgradeResponseHeader(header http.Header, originReq *http.Request) (http.Header, error) {
+	responseHeader := header.Clone()
+	// these headers are written by websocket.Upgrader
+	for _, k := range []string{"Upgrade", "Connection", "Sec-Websocket-Accept", "Sec-Websocket-Extensions", "Content-Length", "Content-Type"} {
+		responseHeader.Del(k)
+	}
+	offered := websocket.Subprotocols(originReq)
+	selected := responseHeader.Get("Sec-Websocket-Protocol")
+	if len(offered) == 0 && selected == "" {
+		return responseHeader, nil
+	}
+	for _, protocol := range offered {
+		if protocol == selected {
+			return responseHeader, nil
+		}
+	}
+	if selected == "" {
+		return nil, fmt.Errorf("$connect handler did not select subprotocol from %v", offered)
+	}
+	return nil, fmt.Errorf("$connect handler selected subprotocol %q, that is not offered %v", selected, offered)
 }
 
 func (h *WebsocketHTTPBridgeHandler) onDisonnect(connectionID string) {
 	h.removeFromConnectionList(connectionID, websocket.CloseNormalClosure, "Connection Closed Normally")
-	requsetID, err := generateID(11)
-	if err != nil {
-		requsetID = "00000000="
-	}
+	authorizer := h.getConnectionAuthorizer(connectionID)
+	reason := h.popDisconnectReason(connectionID)
 	connectedAt, _, originReq := h.popConnectionInfo(connectionID)
 	if originReq == nil {
 		h.logger.Warn("connection info not found", "connection_id", connectionID)
@@ -431,45 +992,28 @@ func (h *WebsocketHTTPBridgeHandler) onDisonnect(connectionID string) {
 			Host:       "unknown",
 		}
 	}
-	proxyCtx := events.APIGatewayWebsocketProxyRequestContext{
-		ConnectionID:      connectionID,
-		RequestID:         requsetID,
-		ExtendedRequestID: requsetID,
-		EventType:         "DISCONNECT",
-		RouteKey:          "$disconnect",
-		DomainName:        originReq.Host,
-		Identity: events.APIGatewayRequestIdentity{
-			SourceIP: originReq.RemoteAddr,
-		},
-		ConnectedAt:      int64(connectedAt.UnixNano() / int64(time.Millisecond)),
-		RequestTime:      time.Now().Format(time.Layout),
-		RequestTimeEpoch: int64(time.Now().UnixNano() / int64(time.Millisecond)),
-		MessageDirection: "IN",
-	}
-	ctx := contextWithRequestContext(context.Background(), proxyCtx)
-	ctx = contextWithCallbackURL(ctx, h.callbackURL)
-	req, err := h.newBridgeRequest(
-		ctx,
-		connectionID,
-		originReq.Host,
-		"DISCONNECT",
-		"$disconnect",
-		bytes.NewReader([]byte{}),
-	)
+	h.invokeDisconnect(connectionID, connectedAt, originReq, authorizer, reason)
+}
+
+// invokeDisconnect invokes $disconnect handler of the connection.
+func (h *WebsocketHTTPBridgeHandler) invokeDisconnect(connectionID string, connectedAt time.Time, originReq *http.Request, authorizer interface{}, reason DisconnectStatus) {
+	proxyReq, err := h.newProxyRequest(connectionID, connectedAt, "DISCONNECT", "$disconnect", originReq)
 	if err != nil {
-		h.logger.ErrorContext(ctx, "failed to create bridge request", "detail", err)
+		h.logger.Error("failed to create bridge request", "detail", err, "connection_id", connectionID)
+		return
+	}
+	proxyReq.RequestContext.Authorizer = authorizer
+	ctx := contextWithDisconnectStatus(context.Background(), reason)
+	if _, err := h.invoke(ctx, proxyReq); err != nil {
+		h.logger.Error("failed to invoke disconnect handler", "detail", err, "connection_id", connectionID)
 		return
 	}
-	req.Header.Set(HTTPHeaderConnectionID, connectionID)
-	req.Header.Set(HTTPHeaderRequestID, requsetID)
-	req.Header.Set(HTTPHeaderEventType, "DISCONNECT")
-	req.Header.Set(HTTPHeaderRouteKey, "$disconnect")
-	respWriter := NewResponseWriter()
-	h.Handler.ServeHTTP(respWriter, req)
 	if h.verbose {
 		h.logger.Info(
 			"disconnected",
 			"connection_id", connectionID,
+			"disconnect_status_code", reason.StatusCode,
+			"disconnect_reason", reason.Reason,
 			"remote_addr", originReq.RemoteAddr,
 			"host", originReq.Host,
 			"current_connections", h.currentConnections(),
@@ -477,12 +1021,7 @@ func (h *WebsocketHTTPBridgeHandler) onDisonnect(connectionID string) {
 	}
 }
 
-func (h *WebsocketHTTPBridgeHandler) onReceiveMessage(connectionID string, ws *websocket.Conn, msg []byte) error {
-	requsetID, err := generateID(11)
-	if err != nil {
-		h.removeFromConnectionList(connectionID, websocket.CloseInternalServerErr, "failed to generate request id")
-		return err
-	}
+func (h *WebsocketHTTPBridgeHandler) onReceiveMessage(connectionID string, cw *connWriter, messageType int, msg []byte) error {
 	connectedAt, _, originReq := h.getConnectionInfo(connectionID)
 	routeKey, err := h.routeKeySelector(msg)
 	if err != nil {
@@ -497,51 +1036,112 @@ func (h *WebsocketHTTPBridgeHandler) onReceiveMessage(connectionID string, ws *w
 		}
 		routeKey = "$default"
 	}
-	proxyCtx := events.APIGatewayWebsocketProxyRequestContext{
-		ConnectionID:      connectionID,
-		RequestID:         requsetID,
-		ExtendedRequestID: requsetID,
-		EventType:         "MESSAGE",
-		RouteKey:          routeKey,
-		DomainName:        originReq.Host,
-		Identity: events.APIGatewayRequestIdentity{
-			SourceIP: originReq.RemoteAddr,
-		},
-		ConnectedAt:      int64(connectedAt.UnixNano() / int64(time.Millisecond)),
-		RequestTime:      time.Now().Format(time.Layout),
-		RequestTimeEpoch: int64(time.Now().UnixNano() / int64(time.Millisecond)),
-		MessageDirection: "IN",
-	}
-	ctx := contextWithRequestContext(context.Background(), proxyCtx)
-	ctx = contextWithCallbackURL(ctx, h.callbackURL)
-	req, err := h.newBridgeRequest(
-		ctx,
-		connectionID,
-		originReq.Host,
-		"MESSAGE",
-		routeKey,
-		bytes.NewReader(msg),
-	)
+	proxyReq, err := h.newProxyRequest(connectionID, connectedAt, "MESSAGE", routeKey, originReq)
+	if err != nil {
+		h.removeFromConnectionList(connectionID, websocket.CloseInternalServerErr, "failed to create bridge request")
+		return err
+	}
+	messageID, err := generateID(11)
+	if err != nil {
+		h.removeFromConnectionList(connectionID, websocket.CloseInternalServerErr, "failed to generate message id")
+		return err
+	}
+	proxyReq.RequestContext.MessageID = messageID
+	if messageType == websocket.BinaryMessage {
+		proxyReq.Body = base64.StdEncoding.EncodeToString(msg)
+		proxyReq.IsBase64Encoded = true
+	} else {
+		proxyReq.Body = string(msg)
+	}
+	respWriter, err := h.invoke(context.Background(), proxyReq)
 	if err != nil {
 		h.removeFromConnectionList(connectionID, websocket.CloseInternalServerErr, "failed to create bridge request")
 		return err
 	}
-	req.Header.Set(HTTPHeaderConnectionID, connectionID)
-	req.Header.Set(HTTPHeaderRequestID, requsetID)
-	req.Header.Set(HTTPHeaderEventType, "MESSAGE")
-	req.Header.Set(HTTPHeaderRouteKey, routeKey)
-	respWriter := NewResponseWriter()
-	h.Handler.ServeHTTP(respWriter, req)
-	var messageType int
+	if !h.hasRouteResponse(routeKey) {
+		h.debugVerbose("route response is not configured, discard integration response", "connection_id", connectionID, "route_key", routeKey)
+		h.markActiveAt(connectionID)
+		return nil
+	}
+	if len(respWriter.Bytes()) == 0 {
+		// same as API Gateway, empty integration response is not sent to the client.
+		h.debugVerbose("integration response is empty, nothing to send", "connection_id", connectionID, "route_key", routeKey)
+		h.markActiveAt(connectionID)
+		return nil
+	}
+	var respMessageType int
 	if isBinary(respWriter.header) {
-		messageType = websocket.BinaryMessage
+		respMessageType = websocket.BinaryMessage
 	} else {
-		messageType = websocket.TextMessage
+		respMessageType = websocket.TextMessage
 	}
-	if err := ws.WriteMessage(messageType, respWriter.Bytes()); err != nil {
+	if err := cw.write(context.Background(), respMessageType, respWriter.Bytes()); err != nil {
 		h.removeFromConnectionList(connectionID, websocket.CloseInternalServerErr, "failed to send message")
 		return err
 	}
 	h.markActiveAt(connectionID)
 	return nil
 }
+
+func (h *WebsocketHTTPBridgeHandler) authorize(originReq *http.Request, proxyCtx events.APIGatewayWebsocketProxyRequestContext) (map[string]interface{}, int, error) {
+	methodArn := localMethodArn(proxyCtx.Stage, proxyCtx.RouteKey)
+	authReq := &events.APIGatewayCustomAuthorizerRequestTypeRequest{
+		Type:                            "REQUEST",
+		MethodArn:                       methodArn,
+		Resource:                        proxyCtx.RouteKey,
+		Path:                            originReq.URL.Path,
+		HTTPMethod:                      http.MethodGet,
+		Headers:                         make(map[string]string),
+		MultiValueHeaders:               make(map[string][]string),
+		QueryStringParameters:           make(map[string]string),
+		MultiValueQueryStringParameters: make(map[string][]string),
+		RequestContext: events.APIGatewayCustomAuthorizerRequestTypeRequestContext{
+			Path:      originReq.URL.Path,
+			AccountID: localAccountID,
+			Stage:     proxyCtx.Stage,
+			RequestID: proxyCtx.RequestID,
+			Identity: events.APIGatewayCustomAuthorizerRequestTypeRequestIdentity{
+				SourceIP: proxyCtx.Identity.SourceIP,
+			},
+			HTTPMethod: http.MethodGet,
+			APIID:      localAPIID,
+		},
+	}
+	authReq.Headers["Host"] = originReq.Host
+	authReq.MultiValueHeaders["Host"] = []string{originReq.Host}
+	for k, v := range originReq.Header {
+		if len(v) == 0 {
+			continue
+		}
+		authReq.Headers[k] = v[len(v)-1]
+		authReq.MultiValueHeaders[k] = v
+	}
+	for k, v := range originReq.URL.Query() {
+		if len(v) == 0 {
+			continue
+		}
+		authReq.QueryStringParameters[k] = v[len(v)-1]
+		authReq.MultiValueQueryStringParameters[k] = v
+	}
+	start := time.Now()
+	resp, err := h.authorizer(originReq.Context(), authReq)
+	if err != nil {
+		if errors.Is(err, ErrUnauthorized) {
+			return nil, http.StatusUnauthorized, err
+		}
+		h.logger.ErrorContext(originReq.Context(), "authorizer failed", "detail", err)
+		return nil, http.StatusInternalServerError, err
+	}
+	if resp == nil || !isAllowed(resp.PolicyDocument, methodArn) {
+		return nil, http.StatusForbidden, errors.New("forbidden by authorizer")
+	}
+	return authorizerContext(resp, time.Since(start).Milliseconds()), http.StatusOK, nil
+}
+
+func sourceIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
@@ -16,6 +16,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi/types"
 	"github.com/gorilla/websocket"
 	"github.com/mashiike/elevate"
 )
@@ -333,3 +334,863 @@ func TestWebsocketHTTPBridgeHandler(t *testing.T) {
 		}
 	})
 }
+
+func TestWebsocketHTTPBridgeHandler__ConnectQuery(t *testing.T) {
+	var mu sync.Mutex
+	rooms := make(map[string]string)
+	mux := elevate.NewRouteMux()
+	mux.HandleConnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		room := req.URL.Query().Get("room")
+		if room == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if elevate.QueryStringParameters(req)["room"] != room {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		mu.Lock()
+		rooms[elevate.ConnectionID(req)] = room
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	mux.HandleDefault(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		bs, err := io.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		mu.Lock()
+		room := rooms[elevate.ConnectionID(req)]
+		mu.Unlock()
+		fmt.Fprintf(w, "%s:%s:%x", room, req.URL.RawQuery, bs)
+	}))
+	handler := elevate.NewWebsocketHTTPBridgeHandler(mux)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	handler.SetCallbackURL(server.URL)
+	connectURL := "ws://" + server.Listener.Addr().String() + "/"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, resp, err := websocket.DefaultDialer.DialContext(ctx, connectURL, nil)
+	if err == nil {
+		t.Fatal("dial without room succeeded; want error")
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("resp.StatusCode = %d; want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+	c, _, err := websocket.DefaultDialer.DialContext(ctx, connectURL+"?room=abc&token=xyz", nil)
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	defer c.Close()
+	if err := c.WriteMessage(websocket.BinaryMessage, []byte{0x00, 0xff}); err != nil {
+		t.Fatal("write:", err)
+	}
+	_, message, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal("read:", err)
+	}
+	if string(message) != "abc::00ff" {
+		t.Errorf("unexpected message: `%s`", message)
+	}
+}
+
+func TestWebsocketHTTPBridgeHandler__RouteResponse(t *testing.T) {
+	mux := elevate.NewRouteMux()
+	mux.HandleFunc("echo", func(w http.ResponseWriter, req *http.Request) {
+		io.Copy(w, req.Body)
+	})
+	mux.HandleDefault(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, "default")
+	}))
+	handler := elevate.NewWebsocketHTTPBridgeHandler(mux)
+	handler.SetDefaultRouteResponse(false)
+	handler.SetRouteResponse("echo", true)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	handler.SetCallbackURL(server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, _, err := websocket.DefaultDialer.DialContext(ctx, "ws://"+server.Listener.Addr().String()+"/", nil)
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	defer c.Close()
+	for _, msg := range []string{`hello`, `{"action":"echo"}`} {
+		if err := c.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			t.Fatal("write:", err)
+		}
+	}
+	_, message, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal("read:", err)
+	}
+	if string(message) != `{"action":"echo"}` {
+		t.Errorf("unexpected message: `%s`", message)
+	}
+}
+
+func TestWebsocketHTTPBridgeHandler__EmptyRouteResponse(t *testing.T) {
+	mux := elevate.NewRouteMux()
+	mux.HandleFunc("silent", func(w http.ResponseWriter, req *http.Request) {})
+	mux.HandleDefault(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, "default")
+	}))
+	handler := elevate.NewWebsocketHTTPBridgeHandler(mux)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	handler.SetCallbackURL(server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, _, err := websocket.DefaultDialer.DialContext(ctx, "ws://"+server.Listener.Addr().String()+"/", nil)
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	defer c.Close()
+	for _, msg := range []string{`{"action":"silent"}`, `hello`} {
+		if err := c.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			t.Fatal("write:", err)
+		}
+	}
+	// the route response of silent route is empty, so the first frame is the response of $default.
+	_, message, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal("read:", err)
+	}
+	if string(message) != "default" {
+		t.Errorf("message = %q; want default, empty frame should not be sent", message)
+	}
+}
+
+func TestWebsocketHTTPBridgeHandler__PostFromBackground(t *testing.T) {
+	connected := make(chan string, 1)
+	mux := elevate.NewRouteMux()
+	mux.HandleConnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		connected <- elevate.ConnectionID(req)
+	}))
+	handler := elevate.NewWebsocketHTTPBridgeHandler(mux)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	handler.SetCallbackURL(server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, _, err := websocket.DefaultDialer.DialContext(ctx, "ws://"+server.Listener.Addr().String()+"/", nil)
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	defer c.Close()
+	connectionID := <-connected
+
+	// outside of the request, like SQS consumer
+	bgCtx := elevate.ContextWithCallbackURL(ctx, server.URL)
+	if err := elevate.PostToConnection(bgCtx, connectionID, []byte("from background")); err != nil {
+		t.Fatal(err)
+	}
+	_, message, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal("read:", err)
+	}
+	if string(message) != "from background" {
+		t.Errorf("unexpected message: `%s`", message)
+	}
+	if err := elevate.PostToConnection(context.Background(), connectionID, []byte("no callback url")); err == nil {
+		t.Error("PostToConnection() without callback url succeeded; want error")
+	}
+}
+
+func TestWebsocketHTTPBridgeHandler__ConcurrentWrites(t *testing.T) {
+	const (
+		numMessages = 50
+		numPosters  = 5
+		numPosts    = 20
+	)
+	connected := make(chan string, 1)
+	mux := elevate.NewRouteMux()
+	mux.HandleConnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		connected <- elevate.ConnectionID(req)
+	}))
+	mux.HandleDefault(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.Copy(w, req.Body)
+	}))
+	handler := elevate.NewWebsocketHTTPBridgeHandler(mux)
+	handler.SetOutboundQueueSize(4)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	handler.SetCallbackURL(server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, _, err := websocket.DefaultDialer.DialContext(ctx, "ws://"+server.Listener.Addr().String()+"/", nil)
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	defer c.Close()
+	connectionID := <-connected
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, numPosters*numPosts+1)
+	bgCtx := elevate.ContextWithCallbackURL(ctx, server.URL)
+	for i := 0; i < numPosters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < numPosts; j++ {
+				if err := elevate.PostToConnection(bgCtx, connectionID, []byte(fmt.Sprintf("post %d-%d", i, j))); err != nil {
+					errCh <- err
+				}
+			}
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < numMessages; i++ {
+			if err := c.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("chat %d", i))); err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}()
+	received := 0
+	for received < numMessages+numPosters*numPosts {
+		if err := c.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := c.ReadMessage(); err != nil {
+			t.Fatalf("read after %d messages: %v", received, err)
+		}
+		received++
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		t.Error(err)
+	}
+}
+
+func TestWebsocketHTTPBridgeHandler__Timeout(t *testing.T) {
+	cases := []struct {
+		name        string
+		idleTimeout time.Duration
+		maxDuration time.Duration
+		chatty      bool
+	}{
+		{name: "idle", idleTimeout: 200 * time.Millisecond},
+		{name: "max_duration", idleTimeout: 200 * time.Millisecond, maxDuration: 500 * time.Millisecond, chatty: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			disconnected := make(chan int, 1)
+			mux := elevate.NewRouteMux()
+			mux.HandleDisconnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				code, _ := elevate.DisconnectReason(req)
+				disconnected <- code
+			}))
+			handler := elevate.NewWebsocketHTTPBridgeHandler(mux)
+			handler.SetIdleTimeout(c.idleTimeout)
+			handler.SetMaxConnectionDuration(c.maxDuration)
+			handler.SetRouteResponse(elevate.RouteKeyDefault, false)
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			handler.SetCallbackURL(server.URL)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			conn, _, err := websocket.DefaultDialer.DialContext(ctx, "ws://"+server.Listener.Addr().String()+"/", nil)
+			if err != nil {
+				t.Fatal("dial:", err)
+			}
+			defer conn.Close()
+			if c.chatty {
+				go func() {
+					ticker := time.NewTicker(50 * time.Millisecond)
+					defer ticker.Stop()
+					for range ticker.C {
+						if err := conn.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+							return
+						}
+					}
+				}()
+			}
+			closeCode := make(chan int, 1)
+			conn.SetCloseHandler(func(code int, text string) error {
+				closeCode <- code
+				return nil
+			})
+			start := time.Now()
+			if _, _, err := conn.ReadMessage(); err == nil {
+				t.Fatal("read succeeded; want close")
+			}
+			select {
+			case code := <-closeCode:
+				if code != websocket.CloseGoingAway {
+					t.Errorf("close code = %d; want %d", code, websocket.CloseGoingAway)
+				}
+			default:
+				t.Fatal("close frame is not received")
+			}
+			if elapsed := time.Since(start); c.chatty && elapsed < c.maxDuration-100*time.Millisecond {
+				t.Errorf("closed after %s; want after max duration %s", elapsed, c.maxDuration)
+			}
+			select {
+			case code := <-disconnected:
+				if code != websocket.CloseGoingAway {
+					t.Errorf("disconnectStatusCode = %d; want %d", code, websocket.CloseGoingAway)
+				}
+			case <-ctx.Done():
+				t.Fatal("$disconnect is not called")
+			}
+		})
+	}
+}
+
+func TestWebsocketHTTPBridgeHandler__DisconnectReason(t *testing.T) {
+	cases := []struct {
+		name       string
+		closeMsg   []byte
+		wantCode   int
+		wantReason string
+	}{
+		{name: "with_status", closeMsg: websocket.FormatCloseMessage(4000, "bye"), wantCode: 4000, wantReason: "bye"},
+		{name: "without_status", closeMsg: []byte{}, wantCode: websocket.CloseNoStatusReceived, wantReason: "Client-side close frame status not set"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			type reason struct {
+				code int
+				text string
+			}
+			disconnected := make(chan reason, 1)
+			mux := elevate.NewRouteMux()
+			mux.HandleDisconnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				code, text := elevate.DisconnectReason(req)
+				disconnected <- reason{code: code, text: text}
+			}))
+			handler := elevate.NewWebsocketHTTPBridgeHandler(mux)
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			handler.SetCallbackURL(server.URL)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			conn, _, err := websocket.DefaultDialer.DialContext(ctx, "ws://"+server.Listener.Addr().String()+"/", nil)
+			if err != nil {
+				t.Fatal("dial:", err)
+			}
+			defer conn.Close()
+			if err := conn.WriteMessage(websocket.CloseMessage, c.closeMsg); err != nil {
+				t.Fatal("write:", err)
+			}
+			select {
+			case got := <-disconnected:
+				if got.code != c.wantCode {
+					t.Errorf("disconnectStatusCode = %d; want %d", got.code, c.wantCode)
+				}
+				if got.text != c.wantReason {
+					t.Errorf("disconnectReason = %s; want %s", got.text, c.wantReason)
+				}
+			case <-ctx.Done():
+				t.Fatal("$disconnect is not called")
+			}
+		})
+	}
+}
+
+func TestWebsocketHTTPBridgeHandler__PingInterval(t *testing.T) {
+	handler := elevate.NewWebsocketHTTPBridgeHandler(elevate.NewRouteMux())
+	handler.SetPingInterval(50 * time.Millisecond)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	handler.SetCallbackURL(server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, _, err := websocket.DefaultDialer.DialContext(ctx, "ws://"+server.Listener.Addr().String()+"/", nil)
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	defer c.Close()
+	pinged := make(chan struct{}, 1)
+	c.SetPingHandler(func(string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	go c.ReadMessage()
+	select {
+	case <-pinged:
+	case <-ctx.Done():
+		t.Fatal("ping is not received")
+	}
+}
+
+func TestWebsocketHTTPBridgeHandler__MaxMessageSize(t *testing.T) {
+	connected := make(chan string, 1)
+	disconnected := make(chan int, 1)
+	mux := elevate.NewRouteMux()
+	mux.HandleConnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		connected <- elevate.ConnectionID(req)
+	}))
+	mux.HandleDisconnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		code, _ := elevate.DisconnectReason(req)
+		disconnected <- code
+	}))
+	handler := elevate.NewWebsocketHTTPBridgeHandler(mux)
+	handler.SetMaxMessageSize(1024)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	handler.SetCallbackURL(server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, _, err := websocket.DefaultDialer.DialContext(ctx, "ws://"+server.Listener.Addr().String()+"/", nil)
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	defer c.Close()
+	connectionID := <-connected
+
+	bgCtx := elevate.ContextWithCallbackURL(ctx, server.URL)
+	err = elevate.PostToConnection(bgCtx, connectionID, bytes.Repeat([]byte("a"), 1025))
+	var tooLarge *types.PayloadTooLargeException
+	if !errors.As(err, &tooLarge) {
+		t.Errorf("PostToConnection(oversize) error = %v; want PayloadTooLargeException", err)
+	}
+	if err := elevate.PostToConnection(bgCtx, connectionID, bytes.Repeat([]byte("a"), 1024)); err != nil {
+		t.Errorf("PostToConnection(max size) error = %v; want nil", err)
+	}
+	if _, _, err := c.ReadMessage(); err != nil {
+		t.Fatal("read:", err)
+	}
+
+	closeCode := make(chan int, 1)
+	c.SetCloseHandler(func(code int, text string) error {
+		closeCode <- code
+		return nil
+	})
+	if err := c.WriteMessage(websocket.TextMessage, bytes.Repeat([]byte("a"), 1025)); err != nil {
+		t.Fatal("write:", err)
+	}
+	if _, _, err := c.ReadMessage(); err == nil {
+		t.Fatal("read succeeded; want close")
+	}
+	select {
+	case code := <-closeCode:
+		if code != websocket.CloseMessageTooBig {
+			t.Errorf("close code = %d; want %d", code, websocket.CloseMessageTooBig)
+		}
+	default:
+		t.Fatal("close frame is not received")
+	}
+	select {
+	case code := <-disconnected:
+		if code != websocket.CloseMessageTooBig {
+			t.Errorf("disconnectStatusCode = %d; want %d", code, websocket.CloseMessageTooBig)
+		}
+	case <-ctx.Done():
+		t.Fatal("$disconnect is not called")
+	}
+}
+
+func TestWebsocketHTTPBridgeHandler__Shutdown(t *testing.T) {
+	var mu sync.Mutex
+	disconnected := make(map[string]int)
+	mux := elevate.NewRouteMux()
+	mux.HandleDisconnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		code, _ := elevate.DisconnectReason(req)
+		mu.Lock()
+		defer mu.Unlock()
+		disconnected[elevate.ConnectionID(req)] = code
+	}))
+	handler := elevate.NewWebsocketHTTPBridgeHandler(mux)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	handler.SetCallbackURL(server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	closeCodes := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		c, _, err := websocket.DefaultDialer.DialContext(ctx, "ws://"+server.Listener.Addr().String()+"/", nil)
+		if err != nil {
+			t.Fatal("dial:", err)
+		}
+		defer c.Close()
+		c.SetCloseHandler(func(code int, text string) error {
+			closeCodes <- code
+			return c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(time.Second))
+		})
+		go c.ReadMessage()
+	}
+	if err := handler.Shutdown(ctx); err != nil {
+		t.Fatal("shutdown:", err)
+	}
+	for i := 0; i < 2; i++ {
+		if code := <-closeCodes; code != websocket.CloseGoingAway {
+			t.Errorf("close code = %d; want %d", code, websocket.CloseGoingAway)
+		}
+	}
+	mu.Lock()
+	if len(disconnected) != 2 {
+		t.Errorf("$disconnect is called %d times; want 2", len(disconnected))
+	}
+	for id, code := range disconnected {
+		if code != websocket.CloseGoingAway {
+			t.Errorf("disconnectStatusCode of %s = %d; want %d", id, code, websocket.CloseGoingAway)
+		}
+	}
+	mu.Unlock()
+	_, resp, err := websocket.DefaultDialer.DialContext(ctx, "ws://"+server.Listener.Addr().String()+"/", nil)
+	if err == nil {
+		t.Fatal("dial after shutdown succeeded; want error")
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status code = %d; want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+}
+
+func TestWebsocketHTTPBridgeHandler__ShutdownNotDrained(t *testing.T) {
+	connected := make(chan string, 1)
+	release := make(chan struct{})
+	mux := elevate.NewRouteMux()
+	mux.HandleConnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		connected <- elevate.ConnectionID(req)
+	}))
+	mux.HandleDisconnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	handler := elevate.NewWebsocketHTTPBridgeHandler(mux)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	defer close(release)
+	handler.SetCallbackURL(server.URL)
+
+	c, _, err := websocket.DefaultDialer.Dial("ws://"+server.Listener.Addr().String()+"/", nil)
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	defer c.Close()
+	connectionID := <-connected
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err = handler.Shutdown(ctx)
+	var shutdownErr *elevate.ShutdownError
+	if !errors.As(err, &shutdownErr) {
+		t.Fatalf("Shutdown() error = %v; want *ShutdownError", err)
+	}
+	if fmt.Sprint(shutdownErr.ConnectionIDs) != fmt.Sprint([]string{connectionID}) {
+		t.Errorf("ConnectionIDs = %v; want [%s]", shutdownErr.ConnectionIDs, connectionID)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() error = %v; want context.DeadlineExceeded", err)
+	}
+}
+
+func TestWebsocketHTTPBridgeHandler__Subprotocol(t *testing.T) {
+	mux := elevate.NewRouteMux()
+	mux.HandleConnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Elevate-Test", "connected")
+		for _, protocol := range strings.Split(req.Header.Get("Sec-WebSocket-Protocol"), ",") {
+			if strings.TrimSpace(protocol) == "chat.v2" {
+				w.Header().Set("Sec-WebSocket-Protocol", "chat.v2")
+			}
+		}
+	}))
+	handler := elevate.NewWebsocketHTTPBridgeHandler(mux)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	handler.SetCallbackURL(server.URL)
+
+	cases := []struct {
+		name         string
+		subprotocols []string
+		want         string
+		wantStatus   int
+	}{
+		{name: "selected", subprotocols: []string{"chat.v1", "chat.v2"}, want: "chat.v2", wantStatus: http.StatusSwitchingProtocols},
+		{name: "not_selected", subprotocols: []string{"chat.v1"}, wantStatus: http.StatusBadRequest},
+		{name: "not_offered", wantStatus: http.StatusSwitchingProtocols},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dialer := websocket.Dialer{Subprotocols: c.subprotocols}
+			conn, resp, err := dialer.Dial("ws://"+server.Listener.Addr().String()+"/", nil)
+			if resp == nil {
+				t.Fatal("dial:", err)
+			}
+			if resp.StatusCode != c.wantStatus {
+				t.Fatalf("status code = %d; want %d", resp.StatusCode, c.wantStatus)
+			}
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			if conn.Subprotocol() != c.want {
+				t.Errorf("Subprotocol() = %s; want %s", conn.Subprotocol(), c.want)
+			}
+			if resp.Header.Get("X-Elevate-Test") != "connected" {
+				t.Errorf("X-Elevate-Test = %s; want connected", resp.Header.Get("X-Elevate-Test"))
+			}
+		})
+	}
+}
+
+func TestWebsocketHTTPBridgeHandler__SubprotocolRejectedCleanup(t *testing.T) {
+	store := elevate.NewInMemoryConnectionStore()
+	disconnected := make(chan int, 1)
+	mux := elevate.NewRouteMux()
+	mux.HandleConnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// accepts the connection without selecting subprotocol.
+		w.WriteHeader(http.StatusOK)
+	}))
+	mux.HandleDisconnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		code, _ := elevate.DisconnectReason(req)
+		disconnected <- code
+	}))
+	handler := elevate.NewWebsocketHTTPBridgeHandler(elevate.NewConnectionStoreHandler(store, mux))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	handler.SetCallbackURL(server.URL)
+
+	dialer := websocket.Dialer{Subprotocols: []string{"chat.v1"}}
+	_, resp, err := dialer.Dial("ws://"+server.Listener.Addr().String()+"/", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Dial() = %v; want 400", err)
+	}
+	select {
+	case code := <-disconnected:
+		if code != websocket.CloseAbnormalClosure {
+			t.Errorf("disconnect status code = %d; want %d", code, websocket.CloseAbnormalClosure)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("$disconnect is not invoked after upgrade is rejected")
+	}
+	conns, err := store.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conns) != 0 {
+		t.Errorf("List() = %d connections; want 0", len(conns))
+	}
+}
+
+func TestWebsocketHTTPBridgeHandler__AllowedOrigins(t *testing.T) {
+	cases := []struct {
+		name       string
+		configure  func(h *elevate.WebsocketHTTPBridgeHandler)
+		origin     string
+		wantStatus int
+	}{
+		{name: "default_same_origin", origin: "http://{{host}}", wantStatus: http.StatusSwitchingProtocols},
+		{name: "default_cross_origin", origin: "http://localhost:3000", wantStatus: http.StatusForbidden},
+		{name: "no_origin", wantStatus: http.StatusSwitchingProtocols},
+		{
+			name:       "list",
+			configure:  func(h *elevate.WebsocketHTTPBridgeHandler) { h.SetAllowedOrigins("http://localhost:3000") },
+			origin:     "http://localhost:3000",
+			wantStatus: http.StatusSwitchingProtocols,
+		},
+		{
+			name:       "list_not_allowed",
+			configure:  func(h *elevate.WebsocketHTTPBridgeHandler) { h.SetAllowedOrigins("http://localhost:3000") },
+			origin:     "http://localhost:4000",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "wildcard",
+			configure:  func(h *elevate.WebsocketHTTPBridgeHandler) { h.SetAllowedOrigins("http://localhost:*") },
+			origin:     "http://LOCALHOST:4000",
+			wantStatus: http.StatusSwitchingProtocols,
+		},
+		{
+			name:       "all",
+			configure:  func(h *elevate.WebsocketHTTPBridgeHandler) { h.SetAllowedOrigins("*") },
+			origin:     "https://example.com",
+			wantStatus: http.StatusSwitchingProtocols,
+		},
+		{
+			name: "func",
+			configure: func(h *elevate.WebsocketHTTPBridgeHandler) {
+				h.SetCheckOrigin(func(r *http.Request) bool {
+					return strings.HasSuffix(r.Header.Get("Origin"), ".example.com")
+				})
+			},
+			origin:     "https://app.example.com",
+			wantStatus: http.StatusSwitchingProtocols,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			connected := false
+			mux := elevate.NewRouteMux()
+			mux.HandleConnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				connected = true
+			}))
+			handler := elevate.NewWebsocketHTTPBridgeHandler(mux)
+			if c.configure != nil {
+				c.configure(handler)
+			}
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			handler.SetCallbackURL(server.URL)
+
+			header := make(http.Header)
+			if c.origin != "" {
+				header.Set("Origin", strings.ReplaceAll(c.origin, "{{host}}", server.Listener.Addr().String()))
+			}
+			conn, resp, err := websocket.DefaultDialer.Dial("ws://"+server.Listener.Addr().String()+"/", header)
+			if resp == nil {
+				t.Fatal("dial:", err)
+			}
+			if conn != nil {
+				conn.Close()
+			}
+			if resp.StatusCode != c.wantStatus {
+				t.Errorf("status code = %d; want %d", resp.StatusCode, c.wantStatus)
+			}
+			if want := c.wantStatus == http.StatusSwitchingProtocols; connected != want {
+				t.Errorf("$connect called = %v; want %v", connected, want)
+			}
+		})
+	}
+}
+
+func TestWebsocketHTTPBridgeHandler__Stage(t *testing.T) {
+	type connectInfo struct {
+		id    string
+		stage string
+		env   string
+	}
+	connected := make(chan connectInfo, 1)
+	mux := elevate.NewRouteMux()
+	mux.HandleConnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		connected <- connectInfo{
+			id:    elevate.ConnectionID(req),
+			stage: elevate.Stage(req),
+			env:   elevate.StageVariables(req)["env"],
+		}
+	}))
+	mux.HandleDefault(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		msg := elevate.Stage(req) + ":" + elevate.StageVariables(req)["env"]
+		if err := elevate.PostToConnection(req.Context(), elevate.ConnectionID(req), []byte(msg)); err != nil {
+			t.Errorf("PostToConnection() error = %v; want nil", err)
+		}
+	}))
+	handler := elevate.NewWebsocketHTTPBridgeHandler(mux)
+	handler.SetStage("develop", map[string]string{"env": "dev"})
+	handler.SetStage("prod", map[string]string{"env": "prod"})
+	handler.SetRouteResponse(elevate.RouteKeyDefault, false)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	handler.SetCallbackURL(server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, resp, err := websocket.DefaultDialer.DialContext(ctx, "ws://"+server.Listener.Addr().String()+"/", nil); err == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("dial without stage: err = %v; want 404", err)
+	}
+	c, _, err := websocket.DefaultDialer.DialContext(ctx, "ws://"+server.Listener.Addr().String()+"/develop", nil)
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	defer c.Close()
+	info := <-connected
+	if info.stage != "develop" || info.env != "dev" {
+		t.Errorf("stage = %s, env = %s; want develop, dev", info.stage, info.env)
+	}
+	if err := c.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+		t.Fatal("write:", err)
+	}
+	_, message, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal("read:", err)
+	}
+	if string(message) != "develop:dev" {
+		t.Errorf("unexpected message: `%s`", message)
+	}
+
+	if err := elevate.PostToConnection(elevate.ContextWithCallbackURL(ctx, server.URL+"/develop"), info.id, []byte("from develop")); err != nil {
+		t.Errorf("PostToConnection(develop) error = %v; want nil", err)
+	}
+	if _, message, err := c.ReadMessage(); err != nil || string(message) != "from develop" {
+		t.Errorf("read = %s, %v; want from develop", message, err)
+	}
+	if err := elevate.PostToConnection(elevate.ContextWithCallbackURL(ctx, server.URL+"/prod"), info.id, []byte("from prod")); !elevate.ConnectionIsGone(err) {
+		t.Errorf("PostToConnection(prod) error = %v; want GoneException", err)
+	}
+	if err := elevate.PostToConnection(elevate.ContextWithCallbackURL(ctx, server.URL), info.id, []byte("without stage")); err == nil {
+		t.Error("PostToConnection(without stage) succeeded; want error")
+	}
+}
+
+func TestWebsocketHTTPBridgeHandler__OutboundQueueFull(t *testing.T) {
+	connected := make(chan string, 1)
+	disconnected := make(chan int, 1)
+	mux := elevate.NewRouteMux()
+	mux.HandleConnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		connected <- elevate.ConnectionID(req)
+	}))
+	mux.HandleDisconnect(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		code, _ := elevate.DisconnectReason(req)
+		disconnected <- code
+	}))
+	handler := elevate.NewWebsocketHTTPBridgeHandler(mux)
+	handler.SetOutboundQueueSize(1)
+	handler.SetWriteTimeout(100 * time.Millisecond)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// the client never reads, messages are piled up until socket buffers are full.
+	c, _, err := websocket.DefaultDialer.DialContext(ctx, "ws://"+server.Listener.Addr().String()+"/", nil)
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	defer c.Close()
+	connectionID := <-connected
+
+	payload := bytes.Repeat([]byte("x"), 100*1024)
+	for i := 0; ; i++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/@connections/"+connectionID, bytes.NewReader(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("post %d: %v", i, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			continue
+		}
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("post %d status = %d; want %d", i, resp.StatusCode, http.StatusTooManyRequests)
+		}
+		if got := resp.Header.Get("X-Amzn-ErrorType"); got != "LimitExceededException" {
+			t.Errorf("X-Amzn-ErrorType = %q; want LimitExceededException", got)
+		}
+		break
+	}
+	// the connection is closed after write timeout, same as gone connection.
+	err = elevate.PostToConnection(elevate.ContextWithCallbackURL(ctx, server.URL), connectionID, []byte("again"))
+	if !elevate.ConnectionIsGone(err) {
+		t.Errorf("PostToConnection() after write timeout error = %v; want GoneException", err)
+	}
+	select {
+	case code := <-disconnected:
+		if code != websocket.CloseAbnormalClosure {
+			t.Errorf("disconnect status code = %d; want %d", code, websocket.CloseAbnormalClosure)
+		}
+	case <-ctx.Done():
+		t.Fatal("$disconnect is not invoked after write timeout")
+	}
+}
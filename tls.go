@@ -0,0 +1,156 @@
+package elevate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+)
+
+// localCertificates are certificates of local httpd served by WithTLS or WithSelfSignedTLS, keyed by host of the callback URL.
+// @connections API client for local bridge trusts them, so PostToConnection works over https in the same process.
+var localCertificates = struct {
+	mu    sync.RWMutex
+	certs map[string]*x509.Certificate
+}{
+	certs: make(map[string]*x509.Certificate),
+}
+
+// trustLocalCertificate trusts the certificate for the host of the callback URL until returned function is called.
+func trustLocalCertificate(callbackURL string, cert *x509.Certificate) func() {
+	u, err := url.Parse(callbackURL)
+	if err != nil || u.Host == "" {
+		return func() {}
+	}
+	localCertificates.mu.Lock()
+	defer localCertificates.mu.Unlock()
+	localCertificates.certs[u.Host] = cert
+	return func() {
+		localCertificates.mu.Lock()
+		defer localCertificates.mu.Unlock()
+		if localCertificates.certs[u.Host] == cert {
+			delete(localCertificates.certs, u.Host)
+		}
+	}
+}
+
+func localCertificate(host string) (*x509.Certificate, bool) {
+	localCertificates.mu.RLock()
+	defer localCertificates.mu.RUnlock()
+	cert, ok := localCertificates.certs[host]
+	return cert, ok
+}
+
+// localHTTPClient returns http client that trusts the certificate of local httpd, nil if not needed.
+func localHTTPClient(endpoint string) *awshttp.BuildableClient {
+	if !strings.HasPrefix(endpoint, "https://") {
+		return nil
+	}
+	if _, isAWS := regionFromEndpoint(endpoint); isAWS {
+		return nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil
+	}
+	if _, ok := localCertificate(u.Host); !ok {
+		return nil
+	}
+	return awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+		tr.TLSClientConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			// the client is cached, so the certificate is looked up on each handshake instead of RootCAs.
+			// local httpd can be restarted on the same address with new certificate.
+			InsecureSkipVerify: true,
+			VerifyConnection: func(cs tls.ConnectionState) error {
+				return verifyLocalCertificate(u.Host, cs)
+			},
+		}
+	})
+}
+
+// verifyLocalCertificate verifies the peer certificate with the certificate of local httpd for the host.
+func verifyLocalCertificate(host string, cs tls.ConnectionState) error {
+	cert, ok := localCertificate(host)
+	if !ok {
+		return fmt.Errorf("elevate: certificate of local httpd %s is not found", host)
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("elevate: no peer certificate")
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	intermediates := x509.NewCertPool()
+	for _, c := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+// generateSelfSignedCertificate generates in-memory certificate for localhost, 127.0.0.1 and ::1.
+func generateSelfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"elevate local development"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// localCallbackURL returns callback URL of local httpd, unspecified address is replaced by localhost.
+func localCallbackURL(scheme string, addr net.Addr) string {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return scheme + "://" + addr.String()
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}